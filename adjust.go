@@ -0,0 +1,395 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/anthonynsimon/bild/adjust"
+	"github.com/anthonynsimon/bild/effect"
+	"github.com/pkg/errors"
+)
+
+// exposure changes the exposure of the image by `ev` stops, like the exposure slider of a raw converter.
+// Unlike scaling the channel values directly, this works on linear light: Each value is converted from sRGB to linear, multiplied by 2^ev, and converted back. A negative `ev` darkens the image and partially recovers blown highlights; a positive `ev` brightens it.
+func exposure(img image.Image, ev float64) image.Image {
+	gain := math.Pow(2, ev)
+
+	if is16Bit(img) {
+		return mapChannels16(img, func(v float64) float64 {
+			return linearToSRGB(clamp01(srgbToLinear(v) * gain))
+		})
+	}
+
+	// There are only 256 possible input values per channel, so a lookup table saves us from calling `math.Pow` for every pixel.
+	var lut [256]uint8
+	for i := range lut {
+		lin := srgbToLinear(float64(i)/255) * gain
+		lut[i] = uint8(math.Round(linearToSRGB(clamp01(lin)) * 255))
+	}
+
+	return adjust.Apply(img, func(c color.RGBA) color.RGBA {
+		return color.RGBA{lut[c.R], lut[c.G], lut[c.B], c.A}
+	})
+}
+
+// gamma applies a gamma correction: Values above 1 brighten the midtones, values below 1 darken them.
+// `adjust.Gamma` works on 8-bit channels, so 16-bit images take a separate path that keeps their full precision.
+func gamma(img image.Image, g float64) image.Image {
+	if is16Bit(img) {
+		return mapChannels16(img, func(v float64) float64 {
+			return math.Pow(v, 1/g)
+		})
+	}
+	return adjust.Gamma(img, g)
+}
+
+// brightness scales all channel values by 1+`change`, where `change` ranges from -1 (black) to 1 (twice as bright). Like `gamma`, it keeps the full precision of 16-bit images.
+func brightness(img image.Image, change float64) image.Image {
+	if is16Bit(img) {
+		return mapChannels16(img, func(v float64) float64 {
+			return v * (1 + change)
+		})
+	}
+	return adjust.Brightness(img, change)
+}
+
+// contrast spreads the channel values away from mid gray by the factor 1+`change`, where `change` ranges from -1 (uniform gray) to 1 (double contrast). Like `gamma`, it keeps the full precision of 16-bit images.
+func contrast(img image.Image, change float64) image.Image {
+	if is16Bit(img) {
+		return mapChannels16(img, func(v float64) float64 {
+			return (v-0.5)*(1+change) + 0.5
+		})
+	}
+	return adjust.Contrast(img, change)
+}
+
+// levels works like the Levels tool of photo editors, with all values in the range [0,1]: The input range from `inBlack` to `inWhite` is stretched to the full range (anything outside is clipped), then the gamma correction `g` is applied as in `gamma`, and finally the result is compressed into the output range from `outBlack` to `outWhite`.
+// This covers brightness, contrast, and gamma changes in a single pass. The same mapping applies to the R, G, and B channels; for per-channel adjustments, use `curves`.
+func levels(img image.Image, inBlack, inWhite, g, outBlack, outWhite float64) (image.Image, error) {
+	if inWhite <= inBlack {
+		return nil, errors.New("levels(): inWhite must be greater than inBlack")
+	}
+	if g <= 0 {
+		return nil, errors.New("levels(): gamma must be positive")
+	}
+	fn := func(v float64) float64 {
+		v = clamp01((v - inBlack) / (inWhite - inBlack))
+		v = math.Pow(v, 1/g)
+		return outBlack + v*(outWhite-outBlack)
+	}
+
+	if is16Bit(img) {
+		return mapChannels16(img, fn), nil
+	}
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(math.Round(clamp01(fn(float64(i)/255)) * 255))
+	}
+	return adjust.Apply(img, func(c color.RGBA) color.RGBA {
+		return color.RGBA{lut[c.R], lut[c.G], lut[c.B], c.A}
+	}), nil
+}
+
+// curvePoint is a control point of a tone curve for `curves`. Both values range from 0 to 1. It is an alias, so callers can pass a plain `[]struct{ In, Out float64 }` as well.
+type curvePoint = struct{ In, Out float64 }
+
+// curves works like the Curves tool of photo editors: The control points define a tone curve that maps input values to output values, and curves applies it to `channel`, which is "r", "g", "b", or "rgb" for all three. An S-shaped curve, for example, adds contrast, and lifting the blue curve in the shadows cools them down.
+// Between the control points, the curve runs in straight lines; below the first point and above the last one, it stays flat. At least two points are required. The identity curve is {0, 0}, {1, 1}.
+func curves(img image.Image, channel string, points []struct{ In, Out float64 }) (image.Image, error) {
+	if len(points) < 2 {
+		return nil, errors.New("curves(): at least two control points are required")
+	}
+	var apply [3]bool
+	switch channel {
+	case "r":
+		apply[0] = true
+	case "g":
+		apply[1] = true
+	case "b":
+		apply[2] = true
+	case "rgb":
+		apply = [3]bool{true, true, true}
+	default:
+		return nil, errors.Errorf("curves(): unknown channel %q", channel)
+	}
+
+	pts := append([]curvePoint(nil), points...)
+	sort.Slice(pts, func(i, j int) bool { return pts[i].In < pts[j].In })
+
+	var lut [256]uint8
+	for i := range lut {
+		v := float64(i) / 255
+		// Find the segment that contains v and interpolate within it.
+		out := pts[len(pts)-1].Out
+		if v <= pts[0].In {
+			out = pts[0].Out
+		}
+		for j := 1; j < len(pts); j++ {
+			lo, hi := pts[j-1], pts[j]
+			if v > lo.In && v <= hi.In {
+				out = lo.Out + (v-lo.In)/(hi.In-lo.In)*(hi.Out-lo.Out)
+				break
+			}
+		}
+		lut[i] = uint8(math.Round(clamp01(out) * 255))
+	}
+
+	mapped := func(v uint8, ch int) uint8 {
+		if apply[ch] {
+			return lut[v]
+		}
+		return v
+	}
+	return adjust.Apply(img, func(c color.RGBA) color.RGBA {
+		return color.RGBA{mapped(c.R, 0), mapped(c.G, 1), mapped(c.B, 2), c.A}
+	}), nil
+}
+
+// posterize reduces each color channel to `levels` evenly spaced values, which gives the image a flat, poster-like look.
+// `levels` must be between 2 and 256; 256 leaves the image unchanged.
+func posterize(img image.Image, levels int) (image.Image, error) {
+	if levels < 2 || levels > 256 {
+		return nil, errors.New("posterize(): levels must be between 2 and 256")
+	}
+
+	// Map each channel value to the nearest of the available levels.
+	step := 255 / float64(levels-1)
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(math.Round(math.Round(float64(i)/step) * step))
+	}
+
+	return adjust.Apply(img, func(c color.RGBA) color.RGBA {
+		return color.RGBA{lut[c.R], lut[c.G], lut[c.B], c.A}
+	}), nil
+}
+
+// tint blends every pixel toward the color `c` by `amount`, which ranges from 0 (no change) to 1 (solid `c`). A touch of orange warms a photo up, a touch of blue cools it down.
+// Values of `amount` outside that range are clamped. The alpha channel stays as it is.
+func tint(img image.Image, c color.Color, amount float64) image.Image {
+	amount = clamp01(amount)
+	if amount == 0 {
+		return img
+	}
+
+	tc := color.RGBAModel.Convert(c).(color.RGBA)
+	mix := func(v, t uint8, a float64) uint8 {
+		return uint8(math.Round(float64(v) + (float64(t)*a-float64(v))*amount))
+	}
+	return adjust.Apply(img, func(px color.RGBA) color.RGBA {
+		// The channels of `px` are premultiplied by its alpha, so the target color has to be, too. Otherwise, semi-transparent pixels would get channels above their alpha.
+		a := float64(px.A) / 255
+		return color.RGBA{mix(px.R, tc.R, a), mix(px.G, tc.G, a), mix(px.B, tc.B, a), px.A}
+	})
+}
+
+// autoWhiteBalance removes a color cast, like the green tint that the grass gives the bird photo. It relies on the "gray world" assumption: On average, the colors of a scene add up to gray, so each channel is scaled until the channel means are equal.
+// The assumption fails for scenes dominated by one color, like a close-up of a leaf. To avoid turning such an image purple, the gain of each channel is limited to the range from 0.5 to 2.
+func autoWhiteBalance(img image.Image) image.Image {
+	samples := samplePixels(img, 10000)
+	if len(samples) == 0 {
+		return img
+	}
+	var sum [3]float64
+	for _, c := range samples {
+		sum[0] += float64(c.R)
+		sum[1] += float64(c.G)
+		sum[2] += float64(c.B)
+	}
+	gray := (sum[0] + sum[1] + sum[2]) / 3
+	if gray == 0 {
+		return img
+	}
+
+	var gains [3]float64
+	for ch := range gains {
+		gains[ch] = 2.0
+		if sum[ch] > 0 {
+			gains[ch] = math.Max(0.5, math.Min(2, gray/sum[ch]))
+		}
+	}
+	return applyGains(img, gains)
+}
+
+// whiteBalance removes a color cast like the white balance eyedropper of photo editors: The pixel at (`refX`, `refY`) shows something that should be neutral gray or white, like a sheet of paper or a concrete wall, and each channel is scaled so that this pixel ends up gray. To be less sensitive to noise, the reference color is the average of the 3x3 pixels around the reference point.
+// Unlike `autoWhiteBalance`, this works for scenes dominated by one color, as long as something neutral is in the picture. The reference must not be close to pure black, or have a channel that is (nearly) zero, as the gains would become huge.
+func whiteBalance(img image.Image, refX, refY int) (image.Image, error) {
+	b := img.Bounds()
+	if !image.Pt(refX, refY).In(b) {
+		return nil, errors.Errorf("whiteBalance(): reference point (%d,%d) is outside of the image %v", refX, refY, b)
+	}
+
+	// The reference color is un-premultiplied, so that a semi-transparent reference yields the same gains as an opaque one of the same color. Fully transparent pixels have no color and are skipped.
+	var ref [3]float64
+	n := 0
+	area := image.Rect(refX-1, refY-1, refX+2, refY+2).Intersect(b)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			ref[0] += float64(c.R)
+			ref[1] += float64(c.G)
+			ref[2] += float64(c.B)
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, errors.New("whiteBalance(): the reference pixel is transparent")
+	}
+	gray := (ref[0] + ref[1] + ref[2]) / 3
+
+	var gains [3]float64
+	for ch := range gains {
+		// Less than one step of the 0-255 scale on average.
+		if ref[ch] < float64(n) {
+			return nil, errors.New("whiteBalance(): the reference pixel is too dark or too colorful to be neutral")
+		}
+		gains[ch] = gray / ref[ch]
+	}
+	return applyGains(img, gains), nil
+}
+
+// applyGains multiplies the R, G, and B channels of each pixel by the respective gain. Values above the pixel's alpha are clipped: The channels are premultiplied by alpha, so for an opaque pixel, this is 255, and for a semi-transparent one, it is the same as clipping the un-premultiplied value at 255.
+func applyGains(img image.Image, gains [3]float64) image.Image {
+	var luts [3][256]uint8
+	for ch := range luts {
+		for i := range luts[ch] {
+			luts[ch][i] = uint8(math.Round(math.Min(255, float64(i)*gains[ch])))
+		}
+	}
+	clip := func(v, a uint8) uint8 {
+		if v > a {
+			return a
+		}
+		return v
+	}
+	return adjust.Apply(img, func(c color.RGBA) color.RGBA {
+		return color.RGBA{clip(luts[0][c.R], c.A), clip(luts[1][c.G], c.A), clip(luts[2][c.B], c.A), c.A}
+	})
+}
+
+// autoEnhance is a one-call "make it better" button. It packages the article's manual steps, with settings derived from the image itself:
+// First, `autoContrast` stretches the tonal range. Then, a mild saturation boost brings back color, less so if the image is already colorful. Finally, light sharpening crisps up the details.
+// For fine control, call the individual functions instead.
+func autoEnhance(img image.Image) image.Image {
+	img = autoContrast(img)
+
+	// Boost pale images more than colorful ones.
+	boost := 0.3 * (1 - meanSaturation(img))
+	img = adjust.Saturation(img, boost)
+
+	return effect.UnsharpMask(img, 0.6, 0.5)
+}
+
+// autoContrast stretches the tones of the image so that they span the full range from black to white.
+// The darkest and brightest 0.5% of the pixels are ignored when finding the current range, so that a few specks of noise do not spoil the result.
+func autoContrast(img image.Image) image.Image {
+	var hist [256]int
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			hist[color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y]++
+		}
+	}
+	lo, hi := percentile(hist, 0.005), percentile(hist, 0.995)
+	if hi <= lo {
+		return img
+	}
+
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(math.Round(clamp01(float64(i-lo)/float64(hi-lo)) * 255))
+	}
+	return adjust.Apply(img, func(c color.RGBA) color.RGBA {
+		return color.RGBA{lut[c.R], lut[c.G], lut[c.B], c.A}
+	})
+}
+
+// percentile returns the smallest value such that at least the fraction `p` of the histogram's entries are at or below it.
+func percentile(hist [256]int, p float64) int {
+	total := 0
+	for _, n := range hist {
+		total += n
+	}
+	target := int(math.Ceil(p * float64(total)))
+	count := 0
+	for v, n := range hist {
+		count += n
+		if count >= target && count > 0 {
+			return v
+		}
+	}
+	return 255
+}
+
+// meanSaturation returns the average HSV saturation of the image, from 0 (gray) to 1 (fully saturated).
+func meanSaturation(img image.Image) float64 {
+	samples := samplePixels(img, 10000)
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, c := range samples {
+		hi := math.Max(float64(c.R), math.Max(float64(c.G), float64(c.B)))
+		lo := math.Min(float64(c.R), math.Min(float64(c.G), float64(c.B)))
+		if hi > 0 {
+			sum += (hi - lo) / hi
+		}
+	}
+	return sum / float64(len(samples))
+}
+
+// is16Bit reports whether the image stores 16 bits per channel.
+// Such images should not go through `bild`, which converts everything to 8-bit RGBA. Repeated adjustments at 8 bits cause visible banding in smooth gradients.
+func is16Bit(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// mapChannels16 applies `fn` to the R, G, and B channels of each pixel at 16-bit precision and leaves alpha alone. `fn` maps the range [0,1] to [0,1].
+// The result stays 16-bit; it only gets converted to 8 bits if it is saved in an 8-bit format like JPEG.
+func mapChannels16(img image.Image, fn func(float64) float64) *image.NRGBA64 {
+	lut := make([]uint16, 1<<16)
+	for i := range lut {
+		lut[i] = uint16(math.Round(clamp01(fn(float64(i)/0xffff)) * 0xffff))
+	}
+
+	b := img.Bounds()
+	dst := image.NewNRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// Work on non-premultiplied values, so that semi-transparent pixels are adjusted the same way as opaque ones.
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			dst.SetNRGBA64(x, y, color.NRGBA64{lut[c.R], lut[c.G], lut[c.B], c.A})
+		}
+	}
+	return dst
+}
+
+// srgbToLinear converts an sRGB-encoded value in the range [0,1] to linear light.
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts a linear light value in the range [0,1] back to sRGB encoding.
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// clamp01 limits v to the range [0,1].
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestExposureHalvesLinearLight(t *testing.T) {
+	for _, v := range []uint8{64, 128, 200, 255} {
+		img := solidImage(4, 4, color.RGBA{v, v, v, 255})
+		r, _, _, _ := exposure(img, -1).At(1, 1).RGBA()
+
+		before := srgbToLinear(float64(v) / 255)
+		after := srgbToLinear(float64(r) / 0xffff)
+		if math.Abs(after/before-0.5) > 0.02 {
+			t.Errorf("exposure(%d, -1): linear value went from %.4f to %.4f, want about half", v, before, after)
+		}
+	}
+}
+
+func TestPosterize(t *testing.T) {
+	for _, levels := range []int{2, 4, 7} {
+		out, err := posterize(colorGradient(64, 64), levels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var values [3]map[uint32]bool
+		for c := range values {
+			values[c] = map[uint32]bool{}
+		}
+		b := out.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := out.At(x, y).RGBA()
+				values[0][r] = true
+				values[1][g] = true
+				values[2][bl] = true
+			}
+		}
+		for c, v := range values {
+			if len(v) > levels {
+				t.Errorf("posterize(%d): channel %d has %d distinct values", levels, c, len(v))
+			}
+		}
+	}
+
+	if _, err := posterize(colorGradient(4, 4), 1); err == nil {
+		t.Error("posterize(1): want an error")
+	}
+}
+
+func TestTint(t *testing.T) {
+	img := solidImage(4, 4, color.RGBA{100, 100, 100, 255})
+	r, g, b, a := tint(img, color.RGBA{255, 0, 0, 255}, 0.5).At(1, 1).RGBA()
+	if r>>8 <= 100 || g>>8 >= 100 || b>>8 >= 100 {
+		t.Errorf("got %d,%d,%d, want more red and less green and blue than 100", r>>8, g>>8, b>>8)
+	}
+	if a != 0xffff {
+		t.Errorf("got alpha %d, want opaque", a>>8)
+	}
+
+	// A half-transparent pixel gets the same color as an opaque one, at its own alpha.
+	half := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	draw.Draw(half, half.Bounds(), &image.Uniform{color.NRGBA{100, 100, 100, 128}}, image.Point{}, draw.Src)
+	out := tint(half, color.RGBA{255, 0, 0, 255}, 0.5)
+	c := color.RGBAModel.Convert(out.At(1, 1)).(color.RGBA)
+	if c.R > c.A || c.G > c.A || c.B > c.A {
+		t.Errorf("half-transparent pixel: got %v, want no channel above alpha", c)
+	}
+	assertColor(t, "half-transparent pixel", out, 1, 1, color.NRGBA{178, 50, 50, 128}, 2)
+}
+
+func TestGamma16Bit(t *testing.T) {
+	img := gradient16(2048)
+	deep := gamma(img, 2.2)
+	if !is16Bit(deep) {
+		t.Fatalf("gamma returned a %T, want a 16-bit image", deep)
+	}
+	shallow := gamma(toRGBA(img), 2.2)
+
+	if d, s := distinctLevels(deep), distinctLevels(shallow); d <= 4*s {
+		t.Errorf("16-bit path has %d levels, 8-bit path %d; want far more levels at 16 bits", d, s)
+	}
+}
+
+func TestBrightnessContrast16Bit(t *testing.T) {
+	img := gradient16(2048)
+	for _, tc := range []struct {
+		name string
+		fn   func(image.Image) image.Image
+	}{
+		{"brightness", func(img image.Image) image.Image { return brightness(img, -0.5) }},
+		{"contrast", func(img image.Image) image.Image { return contrast(img, 0.3) }},
+	} {
+		deep := tc.fn(img)
+		if !is16Bit(deep) {
+			t.Fatalf("%s returned a %T, want a 16-bit image", tc.name, deep)
+		}
+		shallow := tc.fn(toRGBA(img))
+		if d, s := distinctLevels(deep), distinctLevels(shallow); d <= 4*s {
+			t.Errorf("%s: 16-bit path has %d levels, 8-bit path %d; want far more levels at 16 bits", tc.name, d, s)
+		}
+	}
+
+	// Halving the brightness of white yields mid gray.
+	if r, _, _, _ := brightness(img, -0.5).At(2047, 0).RGBA(); r < 0x7ff0 || r > 0x8010 {
+		t.Errorf("brightness -0.5 of white: got %#x, want about 0x8000", r)
+	}
+}
+
+func TestAutoEnhance(t *testing.T) {
+	// A dull image: a color gradient squeezed into the middle tones.
+	img := toRGBA(colorGradient(64, 64))
+	for i := range img.Pix {
+		if i%4 != 3 {
+			img.Pix[i] = 100 + img.Pix[i]/5
+		}
+	}
+
+	out := autoEnhance(img)
+	if mae, _ := compare(img, out); mae < 1 {
+		t.Errorf("output barely differs from the input (difference %.2f)", mae)
+	}
+	lo0, hi0 := lumRange(img)
+	lo1, hi1 := lumRange(out)
+	if int(hi1)-int(lo1) <= int(hi0)-int(lo0) {
+		t.Errorf("tonal range went from %d-%d to %d-%d, want it wider", lo0, hi0, lo1, hi1)
+	}
+}
+
+func TestAutoWhiteBalance(t *testing.T) {
+	// A gray gradient with a green cast.
+	img := grayGradient(64, 16)
+	for i := 1; i < len(img.Pix); i += 4 {
+		img.Pix[i] = uint8(math.Min(255, float64(img.Pix[i])*1.3+20))
+	}
+	before := spread(channelMeans(img))
+	after := spread(channelMeans(autoWhiteBalance(img)))
+	if after > before/4 {
+		t.Errorf("channel means differ by %.1f after the correction, want much less than the %.1f before", after, before)
+	}
+
+	// A pure green image would need infinite gains; they are capped.
+	green := autoWhiteBalance(solidImage(4, 4, color.RGBA{0, 200, 0, 255}))
+	if r, g, _, _ := green.At(1, 1).RGBA(); r != 0 || g>>8 < 100 {
+		t.Errorf("pure green: got R=%d, G=%d, want the green kept and no red added", r>>8, g>>8)
+	}
+
+	// The red gain is high, and a half-transparent pixel with a lot of red must not end up with more red than alpha.
+	cyan := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(cyan, cyan.Bounds(), &image.Uniform{color.NRGBA{100, 200, 200, 255}}, image.Point{}, draw.Src)
+	cyan.SetNRGBA(0, 0, color.NRGBA{250, 240, 240, 128})
+	c := color.RGBAModel.Convert(autoWhiteBalance(cyan).At(0, 0)).(color.RGBA)
+	if c.R > c.A || c.G > c.A || c.B > c.A || c.A != 128 {
+		t.Errorf("half-transparent pixel: got %v, want alpha 128 and no channel above it", c)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		in, want uint8
+	}{
+		{0, 0}, {51, 0}, {89, 64}, {128, 128}, {166, 192}, {204, 255}, {255, 255},
+	}
+	for _, tt := range tests {
+		img := solidImage(2, 2, color.RGBA{tt.in, tt.in, tt.in, 255})
+		out, err := levels(img, 0.2, 0.8, 1, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _, _, _ := out.At(0, 0).RGBA(); absDiff(r>>8, uint32(tt.want)) > 1 {
+			t.Errorf("levels(%d): got %d, want %d", tt.in, r>>8, tt.want)
+		}
+	}
+
+	if _, err := levels(grayGradient(4, 1), 0.8, 0.2, 1, 0, 1); err == nil {
+		t.Error("inWhite below inBlack: want an error")
+	}
+}
+
+func TestCurves(t *testing.T) {
+	img := colorGradient(32, 32)
+	out, err := curves(img, "rgb", []curvePoint{{0, 0}, {1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(out, img) {
+		t.Error("identity curve: the image changed")
+	}
+
+	// Inverting only the red channel: 0 -> 1, 1 -> 0.
+	px := solidImage(2, 2, color.RGBA{51, 100, 200, 255})
+	out, err = curves(px, "r", []curvePoint{{1, 0}, {0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertColor(t, "inverted red", out, 0, 0, color.NRGBA{204, 100, 200, 255}, 0)
+
+	// A two-point curve that maps 0.2 to 0 and 0.6 to 1, with flat ends.
+	for _, tt := range []struct{ in, want uint8 }{{0, 0}, {51, 0}, {102, 128}, {153, 255}, {255, 255}} {
+		out, err := curves(solidImage(2, 2, color.RGBA{tt.in, tt.in, tt.in, 255}), "rgb", []curvePoint{{0.2, 0}, {0.6, 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertColor(t, "two-point curve", out, 0, 0, color.NRGBA{tt.want, tt.want, tt.want, 255}, 1)
+	}
+
+	if _, err := curves(img, "x", []curvePoint{{0, 0}, {1, 1}}); err == nil {
+		t.Error("unknown channel: want an error")
+	}
+	if _, err := curves(img, "rgb", []curvePoint{{0, 0}}); err == nil {
+		t.Error("a single point: want an error")
+	}
+}
+
+func TestWhiteBalance(t *testing.T) {
+	// White paper under warm light on the left, a red object on the right.
+	img := solidImage(40, 20, color.RGBA{220, 200, 160, 255})
+	draw.Draw(img, image.Rect(20, 0, 40, 20), &image.Uniform{color.RGBA{200, 80, 60, 255}}, image.Point{}, draw.Src)
+
+	out, err := whiteBalance(img, 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, _ := out.At(5, 10).RGBA()
+	if s := spread([3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}); s > 2 {
+		t.Errorf("reference pixel is %d,%d,%d, want neutral gray", r>>8, g>>8, b>>8)
+	}
+	// The same gains apply to the rest of the image, so the red object turns less yellow but stays red.
+	r, g, b, _ = out.At(30, 10).RGBA()
+	if r>>8 <= g>>8 || b>>8 <= 60 {
+		t.Errorf("red object is %d,%d,%d, want it red with more blue than before", r>>8, g>>8, b>>8)
+	}
+
+	for _, p := range []image.Point{{-1, 5}, {40, 5}, {5, 20}} {
+		if _, err := whiteBalance(img, p.X, p.Y); err == nil {
+			t.Errorf("reference %v outside the image: want an error", p)
+		}
+	}
+	if _, err := whiteBalance(solidImage(8, 8, color.RGBA{255, 0, 0, 255}), 4, 4); err == nil {
+		t.Error("pure red reference: want an error")
+	}
+	if _, err := whiteBalance(image.NewNRGBA(image.Rect(0, 0, 8, 8)), 4, 4); err == nil {
+		t.Error("transparent reference: want an error")
+	}
+
+	// A half-transparent copy must get the same colors at half the alpha, not gains distorted by the premultiplied channels.
+	half := image.NewNRGBA(img.Bounds())
+	draw.Draw(half, half.Bounds(), img, image.Point{}, draw.Src)
+	for i := 3; i < len(half.Pix); i += 4 {
+		half.Pix[i] = 128
+	}
+	// Transparent pixels next to the reference have no color and must not count.
+	half.SetNRGBA(4, 9, color.NRGBA{})
+	halfOut, err := whiteBalance(half, 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []image.Point{{5, 10}, {30, 10}} {
+		want := color.NRGBAModel.Convert(out.At(p.X, p.Y)).(color.NRGBA)
+		want.A = 128
+		assertColor(t, fmt.Sprintf("half-transparent pixel %v", p), halfOut, p.X, p.Y, want, 3)
+		c := color.RGBAModel.Convert(halfOut.At(p.X, p.Y)).(color.RGBA)
+		if c.R > c.A || c.G > c.A || c.B > c.A {
+			t.Errorf("half-transparent pixel %v: got %v, want no channel above alpha", p, c)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/pkg/errors"
+)
+
+// compare returns the mean absolute difference between `a` and `b`, averaged over all pixels and the R, G, B, and A channels, on a scale of 0 to 255.
+// Identical images yield 0. Both images must have the same size, but they do not need to share the same origin or color model.
+func compare(a, b image.Image) (meanAbsError float64, err error) {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Dx() != bb.Dx() || ab.Dy() != bb.Dy() {
+		return 0, errors.Errorf("compare(): image sizes differ (%dx%d vs %dx%d)", ab.Dx(), ab.Dy(), bb.Dx(), bb.Dy())
+	}
+	if ab.Empty() {
+		return 0, nil
+	}
+
+	var sum float64
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			sum += absDiff(r1, r2) + absDiff(g1, g2) + absDiff(b1, b2) + absDiff(a1, a2)
+		}
+	}
+
+	// RGBA() returns 16-bit values; scale the result down to the familiar 8-bit range.
+	return sum / float64(4*ab.Dx()*ab.Dy()) / 257, nil
+}
+
+// almostEqual reports whether `a` and `b` have the same size and a mean absolute difference (as returned by `compare`) of at most `tol`.
+func almostEqual(a, b image.Image, tol float64) bool {
+	mae, err := compare(a, b)
+	return err == nil && mae <= tol
+}
+
+// colorDistance returns the Euclidean distance between two colors in RGBA space, scaled to the range from 0 (identical) to 1 (opaque white vs. fully transparent).
+func colorDistance(a, b color.Color) float64 {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	dr, dg, db, da := absDiff(r1, r2), absDiff(g1, g2), absDiff(b1, b2), absDiff(a1, a2)
+	return math.Sqrt(dr*dr+dg*dg+db*db+da*da) / (2 * 0xffff)
+}
+
+// absDiff returns |a-b| as float64.
+func absDiff(a, b uint32) float64 {
+	return math.Abs(float64(a) - float64(b))
+}
+
+// exposureReport returns the mean brightness of the image, from 0 (black) to 1 (white), and a verdict for culling bad photos: "underexposed" if the mean is below 0.2, "overexposed" if it is above 0.8, and "ok" otherwise.
+// Use `exposureReportWith` for other thresholds. Photos of dark or bright scenes, like a night sky or snow, are legitimately dark or bright, so treat the verdict as a hint.
+func exposureReport(img image.Image) (mean float64, verdict string) {
+	return exposureReportWith(img, 0.2, 0.8)
+}
+
+// exposureReportWith works like `exposureReport`, with custom thresholds for the mean brightness.
+func exposureReportWith(img image.Image, dark, bright float64) (mean float64, verdict string) {
+	samples := samplePixels(img, 10000)
+	for _, c := range samples {
+		mean += (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / 255
+	}
+	if len(samples) > 0 {
+		mean /= float64(len(samples))
+	}
+
+	switch {
+	case mean < dark:
+		return mean, "underexposed"
+	case mean > bright:
+		return mean, "overexposed"
+	}
+	return mean, "ok"
+}
+
+// sharpnessScore rates how sharp the image is, as the variance of the Laplacian of its gray values. The Laplacian responds to edges, and a blurry image has few and weak edges, so the variance drops. Higher means sharper.
+// The score depends on the content as well as on the focus, so it works best for comparing similar shots, for example to pick the sharpest one of a burst or to flag outliers in a batch.
+func sharpnessScore(img image.Image) float64 {
+	b := img.Bounds()
+	if b.Dx() < 3 || b.Dy() < 3 {
+		return 0
+	}
+	gray := image.NewGray(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+	g := func(x, y int) float64 { return float64(gray.GrayAt(x, y).Y) }
+
+	// Skip the outermost pixels, which lack some of their neighbors.
+	var sum, sumSq float64
+	n := 0
+	for y := b.Min.Y + 1; y < b.Max.Y-1; y++ {
+		for x := b.Min.X + 1; x < b.Max.X-1; x++ {
+			l := g(x-1, y) + g(x+1, y) + g(x, y-1) + g(x, y+1) - 4*g(x, y)
+			sum += l
+			sumSq += l * l
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+// pHash computes a 64-bit perceptual hash of the image. Unlike a cryptographic hash, similar-looking images get similar hashes, even after resizing, recompression, or small color changes, which makes pHash useful for finding near-duplicate photos.
+// This follows the usual recipe: Shrink the image to 32x32 grayscale pixels, run a discrete cosine transform (DCT), and keep the 8x8 lowest frequencies, which describe the coarse structure of the image. Each bit of the hash tells whether one of these 64 coefficients is above their median.
+// Use `hammingDistance` to compare two hashes.
+func pHash(img image.Image) uint64 {
+	const size, keep = 32, 8
+	small := image.NewGray(image.Rect(0, 0, size, size))
+	draw.Draw(small, small.Bounds(), transform.Resize(img, size, size, transform.Box), image.Point{}, draw.Src)
+
+	// The DCT-II along one axis; the cosines are the same for both axes and for every row, so we compute them once.
+	var cosines [keep][size]float64
+	for u := 0; u < keep; u++ {
+		for x := 0; x < size; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+
+	var coeffs [keep * keep]float64
+	for v := 0; v < keep; v++ {
+		for u := 0; u < keep; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					sum += float64(small.GrayAt(x, y).Y) * cosines[u][x] * cosines[v][y]
+				}
+			}
+			coeffs[v*keep+u] = sum
+		}
+	}
+
+	sorted := coeffs
+	sort.Float64s(sorted[:])
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// hammingDistance returns the number of bits in which the hashes `a` and `b` differ. For `pHash` values, a distance of up to about 10 indicates that the images show the same picture.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	a := colorGradient(20, 10)
+	b := colorGradient(20, 10)
+	if mae, err := compare(a, b); err != nil || mae != 0 {
+		t.Errorf("identical images: got %v, %v, want 0", mae, err)
+	}
+
+	b.SetRGBA(3, 4, color.RGBA{0, 0, 0, 0})
+	mae, err := compare(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mae <= 0 || mae > 2 {
+		t.Errorf("one changed pixel: got %v, want a small positive value", mae)
+	}
+	if !almostEqual(a, b, 2) || almostEqual(a, b, 0) {
+		t.Error("almostEqual does not honor the tolerance")
+	}
+
+	if _, err := compare(a, colorGradient(10, 20)); err == nil {
+		t.Error("different sizes: want an error")
+	}
+}
+
+func TestPHash(t *testing.T) {
+	img, err := openImage("cropped.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recompressed, err := jpeg.Decode(bytes.NewReader(encode(t, img, "jpeg", SaveOptions{Quality: 40})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := pHash(img)
+	near := hammingDistance(h, pHash(recompressed))
+	far := hammingDistance(h, pHash(colorGradient(200, 150)))
+	if near > 6 {
+		t.Errorf("recompressed copy: got a distance of %d, want at most 6", near)
+	}
+	if far < 20 {
+		t.Errorf("unrelated image: got a distance of %d, want at least 20", far)
+	}
+}
+
+func TestExposureReport(t *testing.T) {
+	tests := []struct {
+		v    uint8
+		want string
+	}{
+		{20, "underexposed"}, {128, "ok"}, {240, "overexposed"},
+	}
+	for _, tt := range tests {
+		mean, verdict := exposureReport(solidImage(10, 10, color.RGBA{tt.v, tt.v, tt.v, 255}))
+		if verdict != tt.want || math.Abs(mean-float64(tt.v)/255) > 0.01 {
+			t.Errorf("gray %d: got %.2f, %q, want %.2f, %q", tt.v, mean, verdict, float64(tt.v)/255, tt.want)
+		}
+	}
+	if _, verdict := exposureReportWith(solidImage(10, 10, color.RGBA{128, 128, 128, 255}), 0.6, 0.9); verdict != "underexposed" {
+		t.Errorf("mid gray with a dark threshold of 0.6: got %q, want underexposed", verdict)
+	}
+}
+
+func TestSharpnessScore(t *testing.T) {
+	img := checkerboard(64, 64, 4)
+	sharp := sharpnessScore(img)
+	blurred := sharpnessScore(gaussianBlur(img, 2))
+	if blurred >= sharp/2 {
+		t.Errorf("blurred copy scores %.1f, want much less than the original's %.1f", blurred, sharp)
+	}
+	if s := sharpnessScore(solidImage(64, 64, color.Gray{128})); s != 0 {
+		t.Errorf("flat image: got %.1f, want 0", s)
+	}
+}
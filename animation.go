@@ -0,0 +1,150 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// openGIF imports an animated GIF with all its frames from a given path.
+// `openImage` cannot do this: Like `image.Decode`, which it uses, it returns the first frame only.
+func openGIF(path string) (*gif.GIF, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open "+path)
+	}
+	defer f.Close()
+
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "Decoding the GIF failed.")
+	}
+	return g, nil
+}
+
+// processGIF applies `op` to every frame of the animation and returns a new animation. The per-frame delays, disposal methods, and the loop count are kept as they are.
+// A GIF frame often holds only the part of the picture that changed, so `op` gets each frame composited onto the frames before it (see `compositeFrames`). Otherwise, spatial effects such as blurring or sharpening would treat the edges of a partial frame as the edges of the picture. Of the result, only the frame's own rectangle is kept, so the disposal methods still fit.
+// `op` must not change the size of a frame. As the effects produce more colors than a GIF frame can hold, each processed frame gets a new palette via median cut, with one entry reserved for transparency.
+func processGIF(g *gif.GIF, op func(image.Image) image.Image) (*gif.GIF, error) {
+	out := &gif.GIF{
+		Image:           make([]*image.Paletted, len(g.Image)),
+		Delay:           append([]int(nil), g.Delay...),
+		Disposal:        append([]byte(nil), g.Disposal...),
+		LoopCount:       g.LoopCount,
+		Config:          g.Config,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+
+	full := compositeFrames(g)
+	for i, res := range applyToFrames(full, op) {
+		if res.Bounds().Size() != full[i].Bounds().Size() {
+			return nil, errors.Errorf("processGIF(): frame %d changed its size", i)
+		}
+		r := g.Image[i].Bounds()
+		out.Image[i] = toPaletted(subImage(res, r.Sub(full[i].Bounds().Min).Add(res.Bounds().Min)), r)
+	}
+	return out, nil
+}
+
+// toPaletted converts `img` into a paletted image with the bounds `r`. `img` must have the same size as `r`.
+// Most `bild` functions return images that start at (0,0), so the frame is moved back to its original position within the animation here.
+func toPaletted(img image.Image, r image.Rectangle) *image.Paletted {
+	pal := append(medianCut(img, 255), color.RGBA{})
+	dst := image.NewPaletted(r, pal)
+	draw.Draw(dst, r, img, img.Bounds().Min, draw.Src)
+	return dst
+}
+
+// decodeGIFFrames decodes an animated GIF from `r` and returns every frame as a complete picture (see `compositeFrames`), together with the frame delays in 100ths of a second and the loop count, which `encodeGIFFrames` takes back.
+// Use it to process the frames one by one. To apply the same effect to every frame, `openGIF` and `processGIF` are simpler.
+func decodeGIFFrames(r io.Reader) (frames []image.Image, delays []int, loopCount int, err error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, nil, 0, errors.Wrap(err, "Decoding the GIF failed.")
+	}
+	return compositeFrames(g), append([]int(nil), g.Delay...), g.LoopCount, nil
+}
+
+// compositeFrames returns every frame of the animation as the complete picture that a viewer shows at that point.
+// In a GIF file, a frame often only contains the part of the picture that changed since the previous frame. Effects need to see the whole picture, so compositeFrames draws the frames onto a canvas, one after the other, honoring each frame's disposal method.
+func compositeFrames(g *gif.GIF) []image.Image {
+	canvasRect := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	for _, frame := range g.Image {
+		canvasRect = canvasRect.Union(frame.Bounds())
+	}
+	canvas := image.NewRGBA(canvasRect)
+
+	frames := make([]image.Image, len(g.Image))
+	for i, frame := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = toRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames[i] = toRGBA(canvas)
+
+		// Prepare the canvas for the next frame.
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// applyToFrames runs `op` on each frame and returns the processed frames.
+func applyToFrames(frames []image.Image, op func(image.Image) image.Image) []image.Image {
+	out := make([]image.Image, len(frames))
+	for i, frame := range frames {
+		out[i] = op(frame)
+	}
+	return out
+}
+
+// encodeGIFFrames writes the frames as an animated GIF to `w`. `delays` holds the delay of each frame in 100ths of a second, and `loopCount` is the loop count as returned by `decodeGIFFrames`: 0 loops forever, -1 plays the animation once, and n plays it n+1 times.
+// Each frame is written in full and gets its own palette, like the frames of `processGIF` (see `toPaletted`).
+func encodeGIFFrames(w io.Writer, frames []image.Image, delays []int, loopCount int) error {
+	if len(frames) != len(delays) {
+		return errors.Errorf("encodeGIFFrames(): %d frames but %d delays", len(frames), len(delays))
+	}
+
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, len(frames)),
+		Delay:     delays,
+		LoopCount: loopCount,
+	}
+	for i, frame := range frames {
+		g.Image[i] = toPaletted(frame, frame.Bounds())
+	}
+	return errors.Wrap(gif.EncodeAll(w, g), "Failed to encode the GIF")
+}
+
+// saveGIF saves the animation to `pname/fname`.
+func saveGIF(g *gif.GIF, pname, fname string) error {
+	fpath := path.Join(pname, fname)
+
+	f, err := os.Create(fpath)
+	if err != nil {
+		return errors.Wrap(err, "Cannot create file: "+fpath)
+	}
+	err = gif.EncodeAll(f, g)
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "Failed to encode the GIF")
+	}
+	return errors.Wrap(f.Close(), "Cannot close file: "+fpath)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/anthonynsimon/bild/effect"
+)
+
+// testGIF returns an animation of `n` 8x8 frames in shades of gray, with a delay of 10*(i+1) for frame i.
+func testGIF(n int) *gif.GIF {
+	g := &gif.GIF{LoopCount: 3}
+	for i := 0; i < n; i++ {
+		pal := color.Palette{color.Gray{uint8(40 * i)}, color.White}
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 8, 8), pal))
+		g.Delay = append(g.Delay, 10*(i+1))
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	return g
+}
+
+func invert(img image.Image) image.Image {
+	return effect.Invert(img)
+}
+
+func TestProcessGIF(t *testing.T) {
+	g := testGIF(3)
+	out, err := processGIF(g, invert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != 3 {
+		t.Fatalf("got %d frames, want 3", len(out.Image))
+	}
+	for i, frame := range out.Image {
+		want := 255 - uint32(40*i)
+		if r, _, _, _ := frame.At(4, 4).RGBA(); r>>8 != want {
+			t.Errorf("frame %d: got gray %d, want %d", i, r>>8, want)
+		}
+		if out.Delay[i] != g.Delay[i] {
+			t.Errorf("frame %d: got delay %d, want %d", i, out.Delay[i], g.Delay[i])
+		}
+	}
+	if out.LoopCount != g.LoopCount {
+		t.Errorf("got loop count %d, want %d", out.LoopCount, g.LoopCount)
+	}
+}
+
+func TestProcessGIFPartialFrame(t *testing.T) {
+	// The second frame only covers the left half. A blur must see the black right half of the first frame next to it, as a viewer does.
+	g := testGIF(2)
+	g.Image[1] = image.NewPaletted(image.Rect(0, 0, 4, 8), g.Image[1].Palette)
+	out, err := processGIF(g, func(img image.Image) image.Image { return gaussianBlur(img, 1) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := out.Image[1].Bounds(); b != g.Image[1].Bounds() {
+		t.Fatalf("frame 1: got bounds %v, want %v", b, g.Image[1].Bounds())
+	}
+	if r, _, _, _ := out.Image[1].At(0, 4).RGBA(); r>>8 < 38 {
+		t.Errorf("frame 1: got gray %d at the left edge, want about 40", r>>8)
+	}
+	if r, _, _, _ := out.Image[1].At(3, 4).RGBA(); r>>8 >= 38 {
+		t.Errorf("frame 1: got gray %d next to the black area, want it darkened by the blur", r>>8)
+	}
+}
+
+func TestGIFFrames(t *testing.T) {
+	// The second frame only covers the left half, so the right half must show through from the first frame.
+	g := testGIF(2)
+	g.Image[1] = image.NewPaletted(image.Rect(0, 0, 4, 8), g.Image[1].Palette)
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, delays, loopCount, err := decodeGIFFrames(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || len(delays) != 2 {
+		t.Fatalf("got %d frames and %d delays, want 2 each", len(frames), len(delays))
+	}
+	if loopCount != g.LoopCount {
+		t.Errorf("got loop count %d, want %d", loopCount, g.LoopCount)
+	}
+	if r, _, _, _ := frames[1].At(6, 4).RGBA(); r != 0 {
+		t.Errorf("frame 1 does not show frame 0 in the uncovered area")
+	}
+
+	frames = applyToFrames(frames, invert)
+	buf.Reset()
+	if err := encodeGIFFrames(&buf, frames, delays, loopCount); err != nil {
+		t.Fatal(err)
+	}
+	out, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != 2 {
+		t.Fatalf("got %d frames after encoding, want 2", len(out.Image))
+	}
+	if out.LoopCount != g.LoopCount {
+		t.Errorf("got loop count %d after encoding, want %d", out.LoopCount, g.LoopCount)
+	}
+	for i, want := range []uint32{255, 215} {
+		if r, _, _, _ := out.Image[i].At(2, 2).RGBA(); r>>8 != want {
+			t.Errorf("frame %d: got gray %d, want %d", i, r>>8, want)
+		}
+	}
+}
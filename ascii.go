@@ -0,0 +1,48 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// asciiRamp lists characters from dense (dark) to sparse (light).
+const asciiRamp = "@%#*+=-:. "
+
+// toASCII renders the image as ASCII art, `width` characters wide, for dark text on a light background. Each character stands for the average brightness of the pixels it covers.
+// Character cells are about twice as tall as wide, so each line covers twice as many pixel rows as each column covers pixel columns. This keeps the aspect ratio of the picture intact.
+func toASCII(img image.Image, width int) string {
+	b := img.Bounds()
+	if width <= 0 || b.Empty() {
+		return ""
+	}
+	cellW := float64(b.Dx()) / float64(width)
+	cellH := 2 * cellW
+	height := int(math.Max(1, math.Round(float64(b.Dy())/cellH)))
+
+	var sb strings.Builder
+	for row := 0; row < height; row++ {
+		y0 := b.Min.Y + int(float64(row)*cellH)
+		y1 := minInt(b.Max.Y, maxInt(y0+1, b.Min.Y+int(float64(row+1)*cellH)))
+		for col := 0; col < width; col++ {
+			x0 := b.Min.X + int(float64(col)*cellW)
+			x1 := minInt(b.Max.X, maxInt(x0+1, b.Min.X+int(float64(col+1)*cellW)))
+
+			sum, n := 0, 0
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += int(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+					n++
+				}
+			}
+			if n == 0 {
+				sb.WriteByte(' ')
+				continue
+			}
+			sb.WriteByte(asciiRamp[sum/n*(len(asciiRamp)-1)/255])
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestToASCII(t *testing.T) {
+	art := toASCII(grayGradient(200, 100), 20)
+	lines := strings.Split(strings.TrimSuffix(art, "\n"), "\n")
+	// Cells are twice as tall as wide: 200/20 = 10 px wide, 20 px tall.
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines, want 5", len(lines))
+	}
+	for i, line := range lines {
+		if len(line) != 20 {
+			t.Fatalf("line %d has %d characters, want 20", i, len(line))
+		}
+		if line[0] != asciiRamp[0] {
+			t.Errorf("line %d: the dark end is %q, want the dense %q", i, line[0], asciiRamp[0])
+		}
+		if last := line[len(line)-1]; strings.IndexByte(asciiRamp, last) < len(asciiRamp)-2 {
+			t.Errorf("line %d: the light end is %q, want one of the sparse characters", i, last)
+		}
+		for j := 1; j < len(line); j++ {
+			if strings.IndexByte(asciiRamp, line[j]) < strings.IndexByte(asciiRamp, line[j-1]) {
+				t.Fatalf("line %d gets denser from left to right: %q", i, line)
+			}
+		}
+	}
+
+	if got := toASCII(solidImage(10, 10, color.White), 0); got != "" {
+		t.Errorf("width 0: got %q, want empty", got)
+	}
+}
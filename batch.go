@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// BatchError collects the errors of all files that failed during a batch run, keyed by file name.
+type BatchError struct {
+	Errs map[string]error
+}
+
+func (e *BatchError) Error() string {
+	names := make([]string, 0, len(e.Errs))
+	for name := range e.Errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e.Errs[name].Error()
+	}
+	return fmt.Sprintf("%d file(s) failed: %s", len(names), strings.Join(msgs, "; "))
+}
+
+// fileResult is what a worker reports back after processing one file.
+type fileResult struct {
+	name string
+	err  error
+}
+
+// BatchOptions controls a batch run of `processDirStream`. The zero value processes all images.
+type BatchOptions struct {
+	// MinSharpness lets batch runs cull out-of-focus shots: Images whose `sharpnessScore` is below this value are skipped and reported as failed, so they show up in the `BatchError`. The default of 0 processes all images.
+	// A good value depends on the image size and content. Run `sharpnessScore` on a few sharp and blurry samples of the batch to find one.
+	MinSharpness float64
+
+	// Template sets the names of the files that `processDirStream` writes. These tokens get replaced:
+	//
+	// * {name}: the input file name without the extension
+	// * {ext}: the extension of the input file, without the dot
+	// * {index}: the position of the input file in lexical order, starting at 1
+	//
+	// For example, "{name}_thumb.{ext}" turns "cat.jpg" into "cat_thumb.jpg" and "logo.png" into "logo_thumb.png". This keeps the originals intact if the output directory is the input directory. The extension of the output name selects the format (see `saveImageAs`), so {ext} keeps the format of each input file, and "{name}.png" converts all files to PNG. HEIC files cannot be written, though; with {ext} or the default, they are saved as JPEG data under their HEIC name, so give them an explicit extension. The default of "" keeps the input file names.
+	// The expanded names must be plain file names without a directory part, so that all output stays in the output directory. A run that would overwrite one of its input files fails before processing anything.
+	Template string
+}
+
+// processDirStream runs the article's `bild` pipeline on every image file in `inDir` (see `imageFiles`) and saves the results to `outDir`, named after `opts.Template`.
+// A fixed pool of `workers` goroutines does the work, so even thousands of files do not spawn thousands of goroutines. If `workers` is less than 1, it defaults to the number of CPUs.
+// After each file, `progress` (if not nil) receives the number of files done so far and the total. A failing file does not abort the run; all failures are returned together as a `*BatchError`. Cancelling `ctx` stops dispatching new files.
+func processDirStream(ctx context.Context, inDir, outDir string, workers int, opts BatchOptions, progress func(done, total int)) error {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	files, err := imageFiles(inDir)
+	if err != nil {
+		return err
+	}
+	outNames, err := outputNames(opts.Template, files)
+	if err != nil {
+		return err
+	}
+	if err := checkOverwrite(inDir, outDir, files, outNames); err != nil {
+		return err
+	}
+
+	jobs := make(chan int)
+	results := make(chan fileResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- fileResult{files[i], processFile(filepath.Join(inDir, files[i]), outDir, outNames[i], opts)}
+			}
+		}()
+	}
+
+	// Feed the workers until all files are dispatched or the context is cancelled.
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Collect the results here rather than in the workers, so that `progress` is never called concurrently.
+	errs := map[string]error{}
+	done := 0
+	for res := range results {
+		done++
+		if res.err != nil {
+			errs[res.name] = res.err
+		}
+		if progress != nil {
+			progress(done, len(files))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "processDirStream(): run cancelled")
+	}
+	if len(errs) > 0 {
+		return &BatchError{errs}
+	}
+	return nil
+}
+
+// imageExtensions are the file extensions of the formats that `openImage` decodes: the formats registered with the `image` package (see decode.go), and HEIC. HEIC files need a build with `-tags heic`; in other builds, they fail with a message that says so, rather than being skipped silently.
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".heif": true,
+}
+
+// imageFiles returns the names of all image files in `dir` (see `imageExtensions`), in lexical order.
+func imageFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot read directory "+dir)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && imageExtensions[strings.ToLower(filepath.Ext(e.Name()))] {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// outputNames expands the template (see `BatchOptions.Template`) for each of the input file names. An empty template returns the input names. Unknown tokens are an error, and so are a template that maps two input files to the same output name and an expanded name that is not a plain file name.
+func outputNames(tmpl string, files []string) ([]string, error) {
+	if tmpl == "" {
+		return files, nil
+	}
+	names := make([]string, len(files))
+	seen := map[string]string{}
+	for i, file := range files {
+		ext := filepath.Ext(file)
+		name, err := expandTemplate(tmpl, map[string]string{
+			"name":  strings.TrimSuffix(file, ext),
+			"ext":   strings.TrimPrefix(ext, "."),
+			"index": strconv.Itoa(i + 1),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+			return nil, errors.Errorf("outputNames(): %s maps to %q, which is not a plain file name", file, name)
+		}
+		if other, ok := seen[name]; ok {
+			return nil, errors.Errorf("outputNames(): %s and %s both map to %s", other, file, name)
+		}
+		seen[name] = file
+		names[i] = name
+	}
+	return names, nil
+}
+
+// checkOverwrite returns an error if any output file of a batch run would replace one of the input files.
+func checkOverwrite(inDir, outDir string, files, outNames []string) error {
+	absIn, err := filepath.Abs(inDir)
+	if err != nil {
+		return errors.Wrap(err, "checkOverwrite(): cannot resolve "+inDir)
+	}
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return errors.Wrap(err, "checkOverwrite(): cannot resolve "+outDir)
+	}
+	if absIn != absOut {
+		return nil
+	}
+	inputs := map[string]bool{}
+	for _, file := range files {
+		inputs[file] = true
+	}
+	for i, name := range outNames {
+		if inputs[name] {
+			return errors.Errorf("checkOverwrite(): the output of %s would overwrite the input file %s", files[i], name)
+		}
+	}
+	return nil
+}
+
+// expandTemplate replaces each {token} in `tmpl` by its value from `values`.
+func expandTemplate(tmpl string, values map[string]string) (string, error) {
+	var sb strings.Builder
+	rest := tmpl
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return "", errors.Errorf("expandTemplate(): unclosed token in %q", tmpl)
+		}
+		token := rest[open+1 : open+end]
+		v, ok := values[token]
+		if !ok {
+			return "", errors.Errorf("expandTemplate(): unknown token {%s}", token)
+		}
+		sb.WriteString(rest[:open])
+		sb.WriteString(v)
+		rest = rest[open+end+1:]
+	}
+	sb.WriteString(rest)
+	return sb.String(), nil
+}
+
+// processFile saturates and sharpens a single image, just like `main` does, and saves it as `outName` in `outDir`. See `BatchOptions` for which images it skips.
+func processFile(path, outDir, outName string, opts BatchOptions) error {
+	img, err := openImage(path)
+	if err != nil {
+		return err
+	}
+	if opts.MinSharpness > 0 {
+		if score := sharpnessScore(img); score < opts.MinSharpness {
+			return errors.Errorf("skipped as blurry (sharpness %.1f, minimum %.1f)", score, opts.MinSharpness)
+		}
+	}
+	return saveImage(sharpen(saturate(img)), outDir, outName)
+}
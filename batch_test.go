@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeJPEGs creates `n` small JPEG files in `dir`.
+func writeJPEGs(t *testing.T, dir string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		f, err := os.Create(filepath.Join(dir, "img"+strconv.Itoa(i)+".jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = jpeg.Encode(f, grayGradient(32, 24), nil)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProcessDirStream(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeJPEGs(t, in, 5)
+	// Files that are not images are ignored.
+	if err := os.WriteFile(filepath.Join(in, "notes.txt"), []byte("skip me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	last, total := 0, 0
+	err := processDirStream(context.Background(), in, out, 2, BatchOptions{}, func(done, n int) {
+		if done != last+1 {
+			t.Errorf("progress jumped from %d to %d", last, done)
+		}
+		last, total = done, n
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || last != total {
+		t.Errorf("progress ended at %d of %d, want 5 of 5", last, total)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := os.Stat(filepath.Join(out, "img"+strconv.Itoa(i)+".jpg")); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestImageFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.PNG", "c.gif", "d.webp", "e.heic", "f.JPEG", "notes.txt", "raw.cr2"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.jpg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := imageFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a.jpg,b.PNG,c.gif,d.webp,e.heic,f.JPEG"; strings.Join(got, ",") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestProcessDirStreamErrors(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeJPEGs(t, in, 2)
+	if err := os.WriteFile(filepath.Join(in, "broken.jpg"), []byte("not a JPEG"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := processDirStream(context.Background(), in, out, 0, BatchOptions{}, nil)
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("got error %v, want a *BatchError", err)
+	}
+	if len(batchErr.Errs) != 1 || batchErr.Errs["broken.jpg"] == nil {
+		t.Errorf("got failures %v, want only broken.jpg", batchErr.Errs)
+	}
+}
+
+func TestProcessDirStreamMinSharpness(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	for name, img := range map[string]image.Image{
+		"sharp.jpg":  checkerboard(64, 64, 4),
+		"blurry.jpg": gaussianBlur(checkerboard(64, 64, 4), 3),
+	} {
+		if err := os.WriteFile(filepath.Join(in, name), jpegBytes(t, img), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sharp, err := openImage(filepath.Join(in, "sharp.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = processDirStream(context.Background(), in, out, 1, BatchOptions{MinSharpness: sharpnessScore(sharp) / 2}, nil)
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("got error %v, want a *BatchError", err)
+	}
+	if len(batchErr.Errs) != 1 || batchErr.Errs["blurry.jpg"] == nil {
+		t.Errorf("got failures %v, want only blurry.jpg", batchErr.Errs)
+	}
+	if _, err := os.Stat(filepath.Join(out, "sharp.jpg")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOutputNames(t *testing.T) {
+	files := []string{"cat.jpg", "dog.jpeg"}
+	for _, tc := range []struct {
+		tmpl string
+		want []string
+	}{
+		{"", files},
+		{"{name}_thumb.{ext}", []string{"cat_thumb.jpg", "dog_thumb.jpeg"}},
+		{"{index}-{name}.png", []string{"1-cat.png", "2-dog.png"}},
+	} {
+		got, err := outputNames(tc.tmpl, files)
+		if err != nil {
+			t.Errorf("%q: %v", tc.tmpl, err)
+			continue
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%q: got %v, want %v", tc.tmpl, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		tmpl, want string
+	}{
+		{"photo.jpg", "both map to"},
+		{"{name}_{size}.jpg", "unknown token {size}"},
+		{"{name.jpg", "unclosed token"},
+		{"../{name}.{ext}", "not a plain file name"},
+		{"thumbs/{name}.{ext}", "not a plain file name"},
+		{"..", "not a plain file name"},
+	} {
+		if _, err := outputNames(tc.tmpl, files); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got error %v, want one containing %q", tc.tmpl, err, tc.want)
+		}
+	}
+}
+
+func TestProcessDirStreamTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeJPEGs(t, dir, 2)
+
+	// Writing to the input directory keeps the originals next to the converted files.
+	if err := processDirStream(context.Background(), dir, dir, 1, BatchOptions{Template: "{name}_small.png"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		name := "img" + strconv.Itoa(i)
+		if _, err := os.Stat(filepath.Join(dir, name+".jpg")); err != nil {
+			t.Error(err)
+		}
+		f, err := os.Open(filepath.Join(dir, name+"_small.png"))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, _, format, err := imageInfo(f)
+		f.Close()
+		if err != nil || format != "png" {
+			t.Errorf("%s_small.png: got format %q (%v), want png", name, format, err)
+		}
+	}
+}
+
+func TestProcessDirStreamKeepFormat(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeJPEGs(t, in, 1)
+	if err := saveImageAs(colorGradient(32, 24), in, "logo.png", SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// {ext} keeps the format of each input file.
+	if err := processDirStream(context.Background(), in, out, 1, BatchOptions{Template: "{name}_thumb.{ext}"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"img0_thumb.jpg": "jpeg", "logo_thumb.png": "png"} {
+		f, err := os.Open(filepath.Join(out, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, _, format, err := imageInfo(f)
+		f.Close()
+		if err != nil || format != want {
+			t.Errorf("%s: got format %q (%v), want %s", name, format, err, want)
+		}
+	}
+}
+
+func TestProcessDirStreamOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	writeJPEGs(t, dir, 2)
+	orig, err := os.ReadFile(filepath.Join(dir, "img0.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tmpl := range []string{"", "{name}.{ext}"} {
+		// A differently spelled path to the same directory must not slip through.
+		err := processDirStream(context.Background(), dir, dir+string(filepath.Separator)+".", 1, BatchOptions{Template: tmpl}, nil)
+		if err == nil || !strings.Contains(err.Error(), "overwrite") {
+			t.Errorf("%q: got error %v, want one about overwriting the input", tmpl, err)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "img0.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(orig) {
+		t.Error("img0.jpg was overwritten")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/anthonynsimon/bild/blend"
+	"github.com/pkg/errors"
+)
+
+/*
+Besides Multiply, `bild` has a whole set of blend modes. Each of the wrappers below blends `fg` onto `bg`. Both images must have the same size.
+*/
+
+// screen is the inverse of the Multiply blend mode: The result is always lighter.
+func screen(bg, fg image.Image) (image.Image, error) {
+	return blendSameSize("screen", bg, fg, blend.Screen)
+}
+
+// overlay multiplies dark areas and screens light areas of the background, increasing the contrast.
+func overlay(bg, fg image.Image) (image.Image, error) {
+	return blendSameSize("overlay", bg, fg, blend.Overlay)
+}
+
+// softLight is a gentler version of `overlay`.
+func softLight(bg, fg image.Image) (image.Image, error) {
+	return blendSameSize("softLight", bg, fg, blend.SoftLight)
+}
+
+// darken keeps the darker value of each channel.
+func darken(bg, fg image.Image) (image.Image, error) {
+	return blendSameSize("darken", bg, fg, blend.Darken)
+}
+
+// lighten keeps the lighter value of each channel.
+func lighten(bg, fg image.Image) (image.Image, error) {
+	return blendSameSize("lighten", bg, fg, blend.Lighten)
+}
+
+// difference subtracts the darker from the lighter value of each channel. Identical areas turn black.
+func difference(bg, fg image.Image) (image.Image, error) {
+	return blendSameSize("difference", bg, fg, blend.Difference)
+}
+
+// compose places `fg` onto a copy of `bg`, with the top-left corner of `fg` at the offset `at` from the top-left corner of `bg`. Unlike the blend modes, the images can have different sizes, and the alpha channel of `fg` decides how much of the background shines through. This is the way to add a logo or a sticker.
+// Parts of `fg` that stick out of `bg` are cut off.
+func compose(bg, fg image.Image, at image.Point) image.Image {
+	dst := toRGBA(bg)
+	fb := fg.Bounds()
+	topLeft := dst.Bounds().Min.Add(at)
+	draw.Draw(dst, image.Rectangle{topLeft, topLeft.Add(fb.Size())}, fg, fb.Min, draw.Over)
+	return dst
+}
+
+// chromaKey removes a green screen or any other uniform background: Pixels within `tolerance` of the `key` color (see `colorDistance`) become fully transparent, pixels farther away than `tolerance + feather` stay fully opaque, and in between, the alpha rises gradually. `compose` can then put the subject onto a new background.
+// The feather zone catches the pixels along the edges of the subject, which are a mix of subject and background. Fading them out instead of cutting them off avoids a jagged, colored fringe. A `feather` of 0 gives hard edges.
+func chromaKey(img image.Image, key color.Color, tolerance, feather float64) *image.NRGBA {
+	return replaceColor(img, key, color.Transparent, tolerance, feather)
+}
+
+// replaceColor replaces all pixels within `tolerance` of the `target` color (see `colorDistance`) by `replacement`, for recoloring an object or a uniform background. Pixels that are farther away than `tolerance + feather` stay as they are, and in between, they fade gradually from the replacement to the original color. A `feather` of 0 gives hard edges.
+// The fading mixes premultiplied colors, so a transparent replacement only lowers the alpha and keeps the colors, as `chromaKey` needs it.
+func replaceColor(img image.Image, target, replacement color.Color, tolerance, feather float64) *image.NRGBA {
+	rr, rg, rb, ra := replacement.RGBA()
+	mix := func(from, to uint32, w float64) uint16 {
+		return uint16(math.Round(float64(from) + (float64(to)-float64(from))*w))
+	}
+
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.At(x, y)
+			d := colorDistance(c, target)
+			switch {
+			case d <= tolerance:
+				c = replacement
+			case d < tolerance+feather:
+				w := (d - tolerance) / feather
+				r, g, bl, a := c.RGBA()
+				c = color.RGBA64{mix(rr, r, w), mix(rg, g, w), mix(rb, bl, w), mix(ra, a, w)}
+			}
+			dst.Set(x, y, c)
+		}
+	}
+	return dst
+}
+
+// setAlpha makes the image semi-transparent by multiplying the alpha of each pixel by `alpha`, which ranges from 0 (invisible) to 1 (unchanged). Combined with `compose`, this gives a faint watermark or a layer with reduced opacity. The colors stay as they are.
+func setAlpha(img image.Image, alpha float64) (*image.NRGBA, error) {
+	if alpha < 0 || alpha > 1 {
+		return nil, errors.New("setAlpha(): alpha must be between 0 and 1")
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			c.A = uint8(math.Round(float64(c.A) * alpha))
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return dst, nil
+}
+
+// blendSameSize checks that both images have the same size before calling the blend function `fn`. `name` is used for the error message.
+func blendSameSize(name string, bg, fg image.Image, fn func(image.Image, image.Image) *image.RGBA) (image.Image, error) {
+	if bg.Bounds().Size() != fg.Bounds().Size() {
+		return nil, errors.Errorf("%s(): image sizes differ (%v vs %v)", name, bg.Bounds().Size(), fg.Bounds().Size())
+	}
+	return fn(bg, fg), nil
+}
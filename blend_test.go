@@ -0,0 +1,139 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// assertColor fails the test if the pixel at (x,y) differs from `want` by more than `tol` in any channel.
+func assertColor(t *testing.T, name string, img image.Image, x, y int, want color.NRGBA, tol float64) {
+	t.Helper()
+	got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	d := math.Max(math.Max(math.Abs(float64(got.R)-float64(want.R)), math.Abs(float64(got.G)-float64(want.G))),
+		math.Max(math.Abs(float64(got.B)-float64(want.B)), math.Abs(float64(got.A)-float64(want.A))))
+	if d > tol {
+		t.Errorf("%s: pixel (%d,%d) is %v, want %v", name, x, y, got, want)
+	}
+}
+
+func TestBlendModes(t *testing.T) {
+	bg := solidImage(4, 4, color.RGBA{100, 150, 200, 255})
+	fg := solidImage(4, 4, color.RGBA{200, 100, 50, 255})
+
+	tests := []struct {
+		name string
+		fn   func(bg, fg image.Image) (image.Image, error)
+		want color.NRGBA
+	}{
+		{"screen", screen, color.NRGBA{222, 191, 211, 255}},
+		{"overlay", overlay, color.NRGBA{157, 127, 167, 255}},
+		{"darken", darken, color.NRGBA{100, 100, 50, 255}},
+		{"lighten", lighten, color.NRGBA{200, 150, 200, 255}},
+		{"difference", difference, color.NRGBA{100, 50, 150, 255}},
+	}
+	for _, tt := range tests {
+		out, err := tt.fn(bg, fg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		assertColor(t, tt.name, out, 2, 2, tt.want, 2)
+	}
+
+	// Soft light with a mid-gray layer leaves the background as it is.
+	out, err := softLight(bg, solidImage(4, 4, color.RGBA{128, 128, 128, 255}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertColor(t, "softLight", out, 2, 2, color.NRGBA{100, 150, 200, 255}, 2)
+
+	if _, err := screen(bg, solidImage(3, 4, color.Black)); err == nil {
+		t.Error("different sizes: want an error")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	bg := solidImage(20, 20, color.RGBA{0, 0, 255, 255})
+	// Half-transparent red, premultiplied.
+	fg := solidImage(10, 10, color.RGBA{128, 0, 0, 128})
+	out := compose(bg, fg, image.Pt(5, 5))
+
+	assertColor(t, "inside the square", out, 8, 8, color.NRGBA{128, 0, 127, 255}, 1)
+	assertColor(t, "outside the square", out, 2, 2, color.NRGBA{0, 0, 255, 255}, 0)
+	assertColor(t, "right of the square", out, 15, 8, color.NRGBA{0, 0, 255, 255}, 0)
+
+	// A fully transparent foreground leaves the background unchanged, also where it sticks out.
+	out = compose(bg, image.NewRGBA(image.Rect(0, 0, 30, 30)), image.Pt(-5, -5))
+	if !samePixels(out, bg) {
+		t.Error("transparent foreground: the background changed")
+	}
+}
+
+// greenScreen returns a 40x40 green image with a skin-colored 20x20 subject in the middle.
+func greenScreen() *image.RGBA {
+	img := solidImage(40, 40, color.RGBA{0, 200, 0, 255})
+	draw.Draw(img, image.Rect(10, 10, 30, 30), &image.Uniform{color.RGBA{220, 170, 140, 255}}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestChromaKey(t *testing.T) {
+	out := chromaKey(greenScreen(), color.RGBA{0, 200, 0, 255}, 0.1, 0)
+	assertColor(t, "background", out, 2, 2, color.NRGBA{0, 0, 0, 0}, 0)
+	assertColor(t, "subject", out, 20, 20, color.NRGBA{220, 170, 140, 255}, 0)
+
+	// Slightly off-key green is still background.
+	img := greenScreen()
+	img.SetRGBA(3, 3, color.RGBA{10, 190, 10, 255})
+	if a := chromaKey(img, color.RGBA{0, 200, 0, 255}, 0.1, 0).NRGBAAt(3, 3).A; a != 0 {
+		t.Errorf("off-key green: got alpha %d, want 0", a)
+	}
+}
+
+func TestReplaceColor(t *testing.T) {
+	out := replaceColor(greenScreen(), color.RGBA{0, 200, 0, 255}, color.Transparent, 0.1, 0)
+	assertColor(t, "background", out, 2, 2, color.NRGBA{0, 0, 0, 0}, 0)
+	assertColor(t, "subject", out, 20, 20, color.NRGBA{220, 170, 140, 255}, 0)
+
+	out = replaceColor(greenScreen(), color.RGBA{220, 170, 140, 255}, color.RGBA{0, 0, 255, 255}, 0.05, 0)
+	assertColor(t, "recolored subject", out, 20, 20, color.NRGBA{0, 0, 255, 255}, 0)
+	assertColor(t, "kept background", out, 2, 2, color.NRGBA{0, 200, 0, 255}, 0)
+}
+
+func TestChromaKeyFeather(t *testing.T) {
+	img := greenScreen()
+	// A pixel along the edge of the subject is a mix of subject and background.
+	img.SetRGBA(9, 20, color.RGBA{110, 185, 70, 255})
+	out := chromaKey(img, color.RGBA{0, 200, 0, 255}, 0.1, 0.3)
+
+	assertColor(t, "background", out, 2, 2, color.NRGBA{0, 0, 0, 0}, 0)
+	assertColor(t, "subject", out, 20, 20, color.NRGBA{220, 170, 140, 255}, 0)
+	// The edge pixel keeps its color but becomes about half transparent.
+	assertColor(t, "edge", out, 9, 20, color.NRGBA{110, 185, 70, 134}, 3)
+}
+
+func TestSetAlpha(t *testing.T) {
+	img := colorGradient(10, 10)
+	img.SetRGBA(0, 0, color.RGBA{50, 40, 30, 128}) // A half-transparent pixel, premultiplied.
+	out, err := setAlpha(img, 0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if x == 0 && y == 0 {
+				continue
+			}
+			c := img.RGBAAt(x, y)
+			assertColor(t, "opaque pixel", out, x, y, color.NRGBA{c.R, c.G, c.B, 77}, 0)
+		}
+	}
+	assertColor(t, "half-transparent pixel", out, 0, 0, color.NRGBA{100, 80, 60, 38}, 1)
+
+	for _, alpha := range []float64{-0.1, 1.1} {
+		if _, err := setAlpha(img, alpha); err == nil {
+			t.Errorf("alpha %v: want an error", alpha)
+		}
+	}
+}
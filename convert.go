@@ -0,0 +1,159 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// toRGBA returns a copy of the image as `*image.RGBA` with the same bounds. The copy shares no pixels with the original.
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	return dst
+}
+
+// isCMYK reports whether the image uses the CMYK color model. JPEG files from print workflows are often CMYK.
+func isCMYK(img image.Image) bool {
+	_, ok := img.(*image.CMYK)
+	return ok
+}
+
+// toRGB converts the image to RGB. Images that are already RGBA are returned as they are.
+// The conversion uses the simple formulas of the `image/color` package. JPEG files do not tell `image/jpeg` about their ICC color profile, so there is no color management: Expect colors to be plausible, but not an exact match of what a color-managed application shows.
+func toRGB(img image.Image) image.Image {
+	if _, ok := img.(*image.RGBA); ok {
+		return img
+	}
+	return toRGBA(img)
+}
+
+// toCMYK converts the image to CMYK, with the same caveats as `toRGB`. In particular, this is no replacement for a proper, profile-based conversion for print.
+func toCMYK(img image.Image) *image.CMYK {
+	b := img.Bounds()
+	dst := image.NewCMYK(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	return dst
+}
+
+// grayscaleWeighted converts the image to grayscale, mixing the R, G, and B channels with the weights `wr`, `wg`, and `wb`, like a color filter in front of black-and-white film. For example, a strong red weight darkens a blue sky and makes clouds stand out.
+// The weights are normalized to sum up to 1, so only their ratio matters. If they sum up to 0, grayscaleWeighted uses the standard luminance weights 0.299, 0.587, and 0.114.
+func grayscaleWeighted(img image.Image, wr, wg, wb float64) image.Image {
+	sum := wr + wg + wb
+	if sum == 0 {
+		wr, wg, wb, sum = 0.299, 0.587, 0.114, 1
+	}
+	wr, wg, wb = wr/sum, wg/sum, wb/sum
+
+	b := img.Bounds()
+	dst := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			v := wr*float64(c.R) + wg*float64(c.G) + wb*float64(c.B)
+			// Negative weights can push the value out of range.
+			dst.SetGray(x, y, color.Gray{uint8(math.Round(math.Max(0, math.Min(255, v))))})
+		}
+	}
+	return dst
+}
+
+// HSV is a color in the HSV (hue, saturation, value) model. Edits like "make the reds more orange" or "desaturate everything but the sky" are much easier in HSV than in RGB.
+type HSV struct {
+	// H is the hue in degrees, from 0 (red) through 120 (green) and 240 (blue) up to, but excluding, 360.
+	H float64
+	// S is the saturation, from 0 (gray) to 1 (pure color).
+	S float64
+	// V is the value, from 0 (black) to 1 (full brightness).
+	V float64
+}
+
+// rgbToHSV converts a color to HSV. The alpha channel is dropped.
+func rgbToHSV(c color.Color) HSV {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	r, g, b := float64(n.R)/255, float64(n.G)/255, float64(n.B)/255
+	hi := math.Max(r, math.Max(g, b))
+	lo := math.Min(r, math.Min(g, b))
+	d := hi - lo
+
+	hsv := HSV{V: hi}
+	if hi > 0 {
+		hsv.S = d / hi
+	}
+	if d == 0 {
+		return hsv // Gray has no hue.
+	}
+	switch hi {
+	case r:
+		hsv.H = 60 * math.Mod((g-b)/d, 6)
+	case g:
+		hsv.H = 60 * ((b-r)/d + 2)
+	default:
+		hsv.H = 60 * ((r-g)/d + 4)
+	}
+	if hsv.H < 0 {
+		hsv.H += 360
+	}
+	return hsv
+}
+
+// hsvToRGB converts an HSV color back to an opaque RGB color. Hues outside [0,360) wrap around, and S and V are clamped to [0,1].
+func hsvToRGB(hsv HSV) color.NRGBA {
+	h := math.Mod(hsv.H, 360)
+	if h < 0 {
+		h += 360
+	}
+	s, v := clamp01(hsv.S), clamp01(hsv.V)
+
+	// The color lies on one of six sectors of the hue circle. `x` is the channel that rises or falls within the sector.
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+	to8 := func(f float64) uint8 { return uint8(math.Round(clamp01(f+m) * 255)) }
+	return color.NRGBA{to8(r), to8(g), to8(b), 255}
+}
+
+// toHSV converts all pixels of the image to HSV, indexed as [y][x] relative to the image's top-left corner. `fromHSV` turns the result back into an image.
+func toHSV(img image.Image) [][]HSV {
+	b := img.Bounds()
+	pixels := make([][]HSV, b.Dy())
+	for y := range pixels {
+		pixels[y] = make([]HSV, b.Dx())
+		for x := range pixels[y] {
+			pixels[y][x] = rgbToHSV(img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return pixels
+}
+
+// fromHSV builds an opaque image from HSV pixels as returned by `toHSV`. All rows must have the same length.
+func fromHSV(pixels [][]HSV) *image.NRGBA {
+	w := 0
+	if len(pixels) > 0 {
+		w = len(pixels[0])
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, len(pixels)))
+	for y, row := range pixels {
+		for x, hsv := range row {
+			dst.SetNRGBA(x, y, hsvToRGB(hsv))
+		}
+	}
+	return dst
+}
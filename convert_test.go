@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestOpenCMYKImage(t *testing.T) {
+	// testdata/cmyk.jpg is an Adobe CMYK JPEG with a cyan, a magenta, a yellow, and a 50% black block.
+	img, err := openImage("testdata/cmyk.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isCMYK(img) {
+		t.Fatal("openImage returned a CMYK image, want RGB")
+	}
+	want := map[[2]int]color.NRGBA{
+		{4, 4}:   {0, 255, 255, 255},
+		{12, 4}:  {255, 0, 255, 255},
+		{4, 12}:  {255, 255, 0, 255},
+		{12, 12}: {127, 127, 127, 255},
+	}
+	for p, c := range want {
+		assertColor(t, "cmyk.jpg", img, p[0], p[1], c, 3)
+	}
+}
+
+func TestGrayscaleWeighted(t *testing.T) {
+	red := solidImage(4, 4, color.RGBA{200, 30, 30, 255})
+	std := color.GrayModel.Convert(grayscaleWeighted(red, 0, 0, 0).At(1, 1)).(color.Gray).Y
+	if want := color.GrayModel.Convert(red.At(1, 1)).(color.Gray).Y; absDiff(uint32(std), uint32(want)) > 1 {
+		t.Errorf("zero weights: got %d, want the standard luminance %d", std, want)
+	}
+	// Only the ratio of the weights matters.
+	filtered := grayscaleWeighted(red, 2, 0.5, 0.5).At(1, 1).(color.Gray).Y
+	if filtered <= std+40 {
+		t.Errorf("red filter: got %d, want a red object much brighter than the standard %d", filtered, std)
+	}
+	if got := grayscaleWeighted(red, 4, 1, 1).At(1, 1).(color.Gray).Y; got != filtered {
+		t.Errorf("scaled weights: got %d, want %d", got, filtered)
+	}
+}
+
+func TestHSVRoundTrip(t *testing.T) {
+	tests := []struct {
+		c    color.NRGBA
+		want HSV
+	}{
+		{color.NRGBA{255, 0, 0, 255}, HSV{0, 1, 1}},
+		{color.NRGBA{0, 255, 0, 255}, HSV{120, 1, 1}},
+		{color.NRGBA{0, 0, 255, 255}, HSV{240, 1, 1}},
+		{color.NRGBA{255, 0, 255, 255}, HSV{300, 1, 1}},
+		{color.NRGBA{128, 128, 128, 255}, HSV{0, 0, 128.0 / 255}},
+		{color.NRGBA{0, 0, 0, 255}, HSV{0, 0, 0}},
+		{color.NRGBA{255, 128, 0, 255}, HSV{30.1, 1, 1}},
+	}
+	for _, tt := range tests {
+		hsv := rgbToHSV(tt.c)
+		if math.Abs(hsv.H-tt.want.H) > 0.5 || math.Abs(hsv.S-tt.want.S) > 0.01 || math.Abs(hsv.V-tt.want.V) > 0.01 {
+			t.Errorf("rgbToHSV(%v): got %+v, want %+v", tt.c, hsv, tt.want)
+		}
+		if got := hsvToRGB(hsv); got != tt.c {
+			t.Errorf("hsvToRGB(rgbToHSV(%v)): got %v", tt.c, got)
+		}
+	}
+
+	img := colorGradient(16, 16)
+	if out := fromHSV(toHSV(img)); !samePixels(out, img) {
+		t.Error("fromHSV(toHSV(img)) differs from img")
+	}
+}
+
+func TestCMYKCropAndSaturate(t *testing.T) {
+	img, err := openImage("testdata/cmyk.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cropped, err := crop(img, 8, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cropped.Bounds().In(img.Bounds()) || cropped.Bounds().Dx() != cropped.Bounds().Dy() {
+		t.Errorf("got crop %v, want a square within %v", cropped.Bounds(), img.Bounds())
+	}
+
+	// Saturating keeps the pure colors pure and the gray block gray.
+	sat := saturate(img)
+	assertColor(t, "saturated cyan", sat, 4, 4, color.NRGBA{0, 255, 255, 255}, 3)
+	assertColor(t, "saturated magenta", sat, 12, 4, color.NRGBA{255, 0, 255, 255}, 3)
+	assertColor(t, "saturated gray", sat, 12, 12, color.NRGBA{127, 127, 127, 255}, 3)
+}
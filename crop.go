@@ -0,0 +1,374 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/pkg/errors"
+)
+
+// cropAspect auto-crops the image to the aspect ratio `wRatio:hRatio`, for example 16:9.
+// The crop size is the largest rectangle of that ratio that fits into the image, so there is no need to calculate pixel dimensions manually. `smartcrop` then decides where to place it.
+// `safeZone` is an area that the crop must fully contain, like a logo or a caption on a branded asset. If smartcrop places the crop elsewhere, the crop moves just enough to include the safe zone; if the safe zone does not fit into the crop, cropAspect returns an error. An empty rectangle means no safe zone.
+func cropAspect(img image.Image, wRatio, hRatio int, safeZone image.Rectangle) (image.Image, error) {
+	if wRatio <= 0 || hRatio <= 0 {
+		return nil, errors.New("cropAspect(): aspect ratio values must be positive")
+	}
+	if !safeZone.Empty() && !safeZone.In(img.Bounds()) {
+		return nil, errors.Errorf("cropAspect(): safe zone %v is not within the image %v", safeZone, img.Bounds())
+	}
+
+	width, height := aspectSize(img.Bounds().Dx(), img.Bounds().Dy(), wRatio, hRatio)
+	if width == 0 || height == 0 {
+		return nil, errors.New("cropAspect(): image is too small for the requested aspect ratio")
+	}
+	subImg, err := crop(img, width, height)
+	if err != nil || safeZone.Empty() {
+		return subImg, err
+	}
+
+	rect := subImg.Bounds()
+	if safeZone.Dx() > rect.Dx() || safeZone.Dy() > rect.Dy() {
+		return nil, errors.Errorf("cropAspect(): safe zone %v does not fit into the %dx%d crop", safeZone, rect.Dx(), rect.Dy())
+	}
+	return subImage(img, includeRect(rect, safeZone)), nil
+}
+
+// cropSize auto-crops the image to exactly `width` x `height`, for example for batch thumbnails. `crop` picks the largest area with that aspect ratio, which cropSize then scales down to the requested size. If the image is too small for that in either dimension, cropSize returns the largest area with the same aspect ratio instead and never enlarges it, because enlarged images look blurry. The result is then smaller than requested.
+// If `allowUpscale` is true, that area is scaled up to `width` x `height`, so that the result always has the requested size.
+func cropSize(img image.Image, width, height int, allowUpscale bool) (image.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("cropSize(): crop size must be positive")
+	}
+	b := img.Bounds()
+	if width <= b.Dx() && height <= b.Dy() {
+		subImg, err := crop(img, width, height)
+		if err != nil {
+			return nil, err
+		}
+		if sb := subImg.Bounds(); sb.Dx() == width && sb.Dy() == height {
+			return subImg, nil
+		}
+		return transform.Resize(subImg, width, height, transform.Linear), nil
+	}
+
+	subImg, err := cropAspect(img, width, height, image.Rectangle{})
+	if err != nil {
+		return nil, err
+	}
+	if !allowUpscale {
+		return subImg, nil
+	}
+	return transform.Resize(subImg, width, height, transform.Linear), nil
+}
+
+// CropOptions tunes what `cropWithOptions` considers interesting. Each weight sets how much a feature attracts the crop. If all weights are 0, as in the zero value, `cropWithOptions` uses the weights of `defaultCropOptions`, so setting only the padding or the safe zone keeps the default behavior otherwise.
+type CropOptions struct {
+	// EdgeWeight favors areas with many details.
+	EdgeWeight float64
+	// SkinWeight favors skin tones, and therefore people.
+	SkinWeight float64
+	// SaturationWeight favors strongly saturated colors.
+	SaturationWeight float64
+	// Padding gives the subject some breathing room if the crop turns out too tight. Each side of the crop rectangle moves outward by this fraction of the rectangle's width or height, so 0.1 makes the crop up to 20% wider and higher. The rectangle does not grow beyond the image, so the result can be smaller than that, and its aspect ratio can change near the edges.
+	Padding float64
+	// SafeZone is an area that the crop must fully contain, like a logo or a caption. If the interesting part lies elsewhere, the crop rectangle moves just enough to include the safe zone. The safe zone must fit into the crop size. `cropAspect` takes a safe zone as well. The default, an empty rectangle, means no safe zone.
+	SafeZone image.Rectangle
+}
+
+// defaultCropOptions use the same feature weights as `smartcrop`. With these weights, `cropWithOptions` leaves the choice to smartcrop and returns the same rectangle as `crop`.
+var defaultCropOptions = CropOptions{
+	EdgeWeight:       defaultEnergyWeights.Edge,
+	SkinWeight:       defaultEnergyWeights.Skin,
+	SaturationWeight: defaultEnergyWeights.Saturation,
+}
+
+// weights returns the energy weights of the options, or the default weights if all of them are 0.
+func (o CropOptions) weights() (energyWeights, error) {
+	w := energyWeights{Edge: o.EdgeWeight, Skin: o.SkinWeight, Saturation: o.SaturationWeight}
+	if w.Edge < 0 || w.Skin < 0 || w.Saturation < 0 {
+		return energyWeights{}, errors.New("weights must not be negative")
+	}
+	if w == (energyWeights{}) {
+		return defaultEnergyWeights, nil
+	}
+	return w, nil
+}
+
+// proportionalTo reports whether `w` is a positive multiple of `other`, up to rounding errors. Energy maps of proportional weights differ only by a factor, so they rank the crop windows alike.
+func (w energyWeights) proportionalTo(other energyWeights) bool {
+	sum, otherSum := w.Edge+w.Skin+w.Saturation, other.Edge+other.Skin+other.Saturation
+	if sum <= 0 || otherSum <= 0 {
+		return false
+	}
+	const eps = 1e-9
+	return math.Abs(w.Edge/sum-other.Edge/otherSum) < eps &&
+		math.Abs(w.Skin/sum-other.Skin/otherSum) < eps &&
+		math.Abs(w.Saturation/sum-other.Saturation/otherSum) < eps
+}
+
+// cropWithOptions auto-crops the image like `crop`, but with custom weights, padding, and safe zone.
+// The crop rectangle has the size that `crop` picks, which is close to the largest area with the aspect ratio of `width` x `height`, so changing the weights moves the rectangle but does not resize it. With the default weights, or any multiple of them, which ranks the windows the same way, the rectangle is exactly the one from `crop`. `artyom/smartcrop` does not let us change its weights, so for other weights, cropWithOptions computes its own energy map (see `cropHeatmap`) and picks the window of that size with the highest total energy, like `cropCandidates` does.
+// The safe zone and the padding are applied to the chosen rectangle afterwards.
+func cropWithOptions(img image.Image, width, height int, opts CropOptions) (image.Image, error) {
+	if opts.Padding < 0 {
+		return nil, errors.New("cropWithOptions(): padding must not be negative")
+	}
+	wt, err := opts.weights()
+	if err != nil {
+		return nil, errors.Wrap(err, "cropWithOptions()")
+	}
+	sz := opts.SafeZone
+	if !sz.Empty() && !sz.In(img.Bounds()) {
+		return nil, errors.Errorf("cropWithOptions(): safe zone %v is not within the image %v", sz, img.Bounds())
+	}
+
+	subImg, err := crop(img, width, height)
+	if err != nil {
+		return nil, err
+	}
+	rect := subImg.Bounds()
+	if !wt.proportionalTo(defaultEnergyWeights) {
+		windows := scanWindows(computeEnergy(img, wt), rect.Dx(), rect.Dy())
+		if len(windows) == 0 {
+			return nil, errors.Errorf("cropWithOptions(): cannot crop %dx%d from a %dx%d image", rect.Dx(), rect.Dy(), img.Bounds().Dx(), img.Bounds().Dy())
+		}
+		best := windows[0]
+		for _, w := range windows[1:] {
+			if w.score > best.score {
+				best = w
+			}
+		}
+		rect = best.rect
+	}
+
+	if !sz.Empty() {
+		if sz.Dx() > rect.Dx() || sz.Dy() > rect.Dy() {
+			return nil, errors.Errorf("cropWithOptions(): safe zone %v does not fit into the %dx%d crop", sz, rect.Dx(), rect.Dy())
+		}
+		rect = includeRect(rect, sz)
+	}
+	return subImage(img, padRect(rect, opts.Padding, img.Bounds())), nil
+}
+
+// includeRect moves `r` by the shortest distance that makes it contain `inner`, which must not be larger than `r`. If both lie within the image, so does the result.
+func includeRect(r, inner image.Rectangle) image.Rectangle {
+	var d image.Point
+	if inner.Min.X < r.Min.X {
+		d.X = inner.Min.X - r.Min.X
+	} else if inner.Max.X > r.Max.X {
+		d.X = inner.Max.X - r.Max.X
+	}
+	if inner.Min.Y < r.Min.Y {
+		d.Y = inner.Min.Y - r.Min.Y
+	} else if inner.Max.Y > r.Max.Y {
+		d.Y = inner.Max.Y - r.Max.Y
+	}
+	return r.Add(d)
+}
+
+// padRect grows `r` on each side by the fraction `padding` of its width or height, without exceeding `bounds`.
+func padRect(r image.Rectangle, padding float64, bounds image.Rectangle) image.Rectangle {
+	dx := int(math.Round(float64(r.Dx()) * padding))
+	dy := int(math.Round(float64(r.Dy()) * padding))
+	return image.Rect(r.Min.X-dx, r.Min.Y-dy, r.Max.X+dx, r.Max.Y+dy).Intersect(bounds)
+}
+
+// cropCandidates returns up to `n` candidate crop rectangles of `width` x `height`, best first, so that a UI can let the user choose.
+// `artyom/smartcrop` only reveals its single best rectangle, so the candidates come from a sliding window over the energy map (see `cropHeatmap`). Windows that mostly overlap a better candidate are skipped, so the candidates show different parts of the image.
+func cropCandidates(img image.Image, width, height, n int) ([]image.Rectangle, error) {
+	if n <= 0 {
+		return nil, errors.New("cropCandidates(): n must be positive")
+	}
+	windows := scanWindows(computeEnergy(img, defaultEnergyWeights), width, height)
+	if len(windows) == 0 {
+		return nil, errors.Errorf("cropCandidates(): cannot crop %dx%d from a %dx%d image", width, height, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	sort.SliceStable(windows, func(i, j int) bool {
+		return windows[i].score > windows[j].score
+	})
+
+	var rects []image.Rectangle
+	for _, w := range windows {
+		if len(rects) == n {
+			break
+		}
+		distinct := true
+		for _, r := range rects {
+			if overlap(w.rect, r) > 0.5 {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			rects = append(rects, w.rect)
+		}
+	}
+	return rects, nil
+}
+
+// overlap returns the area of the intersection of `a` and `b` divided by the area of their union (0 = disjoint, 1 = identical).
+func overlap(a, b image.Rectangle) float64 {
+	in := a.Intersect(b)
+	if in.Empty() {
+		return 0
+	}
+	area := func(r image.Rectangle) int { return r.Dx() * r.Dy() }
+	return float64(area(in)) / float64(area(a)+area(b)-area(in))
+}
+
+// cropPreview returns a copy of the image with the rectangle that `crop` would choose drawn as an outline, together with that rectangle. This lets a UI show the proposed crop before applying it, and `subImage` applies it afterwards.
+// The outline is drawn inside the rectangle, so that it is visible even if the crop touches the image edges.
+func cropPreview(img image.Image, width, height int) (image.Image, image.Rectangle, error) {
+	subImg, err := crop(img, width, height)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	rect := subImg.Bounds()
+
+	return drawCropRect(img, rect, guideColor), rect, nil
+}
+
+// drawCropRect returns a copy of the image with `r` drawn as an outline in the color `col`, for debugging crops: Pass the rectangle from `smartcrop.Crop` or `cropCandidates` to see what was selected. The outline lies inside `r`, and its thickness scales with the image size.
+func drawCropRect(img image.Image, r image.Rectangle, col color.Color) image.Image {
+	dst := toRGBA(img)
+	drawOutline(dst, r.Intersect(dst.Bounds()), lineWidth(dst.Bounds()), col)
+	return dst
+}
+
+// GuideType selects the composition guides that `drawGuides` draws.
+type GuideType int
+
+const (
+	// GuideThirds divides the image into thirds, horizontally and vertically. The rule of thirds suggests placing the subject on one of the lines or intersections.
+	GuideThirds GuideType = iota
+	// GuideGoldenRatio places the lines at the golden ratio, at about 38.2% and 61.8%, slightly closer to the center than thirds.
+	GuideGoldenRatio
+)
+
+// guideColor is the color of crop outlines and composition guides. Bright red rarely blends into a photo.
+var guideColor = color.RGBA{255, 0, 0, 255}
+
+// drawGuides returns a copy of the image with two horizontal and two vertical composition guides drawn over it. Run it on the result of `crop` to see how the crop aligns with the rule of thirds or the golden ratio.
+func drawGuides(img image.Image, guide GuideType) (image.Image, error) {
+	var frac float64
+	switch guide {
+	case GuideThirds:
+		frac = 1.0 / 3
+	case GuideGoldenRatio:
+		frac = 1 - 1/math.Phi
+	default:
+		return nil, errors.Errorf("drawGuides(): unknown guide type %d", guide)
+	}
+
+	dst := toRGBA(img)
+	b := dst.Bounds()
+	t := lineWidth(b)
+	src := &image.Uniform{guideColor}
+	for _, f := range []float64{frac, 1 - frac} {
+		// Center each line on its position.
+		x := b.Min.X + int(math.Round(float64(b.Dx())*f)) - t/2
+		y := b.Min.Y + int(math.Round(float64(b.Dy())*f)) - t/2
+		draw.Draw(dst, image.Rect(x, b.Min.Y, x+t, b.Max.Y), src, image.Point{}, draw.Src)
+		draw.Draw(dst, image.Rect(b.Min.X, y, b.Max.X, y+t), src, image.Point{}, draw.Src)
+	}
+	return dst, nil
+}
+
+// lineWidth returns a width for outlines and guides that stays visible on large images: 1 pixel per 200 pixels of the shorter side, but at least 1.
+func lineWidth(b image.Rectangle) int {
+	if w := minInt(b.Dx(), b.Dy()) / 200; w > 1 {
+		return w
+	}
+	return 1
+}
+
+// drawOutline draws the border of `r` onto `dst`, `thickness` pixels wide, on the inside of `r`.
+func drawOutline(dst draw.Image, r image.Rectangle, thickness int, col color.Color) {
+	src := &image.Uniform{col}
+	t := minInt(thickness, minInt(r.Dx(), r.Dy()))
+	edges := []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+t), // top
+		image.Rect(r.Min.X, r.Max.Y-t, r.Max.X, r.Max.Y), // bottom
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+t, r.Max.Y), // left
+		image.Rect(r.Max.X-t, r.Min.Y, r.Max.X, r.Max.Y), // right
+	}
+	for _, e := range edges {
+		draw.Draw(dst, e, src, image.Point{}, draw.Src)
+	}
+}
+
+// cropCopy works like `crop` but returns an independent copy instead of a sub-image.
+// The sub-image that `crop` returns shares its pixels with the original: Drawing on the crop also changes the original, and the full-size original stays in memory as long as the crop is in use. cropCopy costs one extra allocation of the cropped size, but afterwards, the original can be modified or garbage-collected freely.
+// The copy keeps the bounds of the cropped area, so its top-left corner is not necessarily at (0,0).
+func cropCopy(img image.Image, width, height int) (image.Image, error) {
+	subImg, err := crop(img, width, height)
+	if err != nil {
+		return nil, err
+	}
+	return toRGBA(subImg), nil
+}
+
+// pad places the image, unscaled, in the center of a `w` x `h` canvas filled with `bg`. This is the opposite of `autoTrim` and comes in handy for letterboxing.
+// If the image is larger than the canvas in either dimension, pad fails, unless `allowCrop` is true; then the parts that stick out are cut off evenly on both sides.
+func pad(img image.Image, w, h int, bg color.Color, allowCrop bool) (image.Image, error) {
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("pad(): canvas size must be positive")
+	}
+	b := img.Bounds()
+	if !allowCrop && (b.Dx() > w || b.Dy() > h) {
+		return nil, errors.Errorf("pad(): image size %dx%d exceeds canvas size %dx%d", b.Dx(), b.Dy(), w, h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+
+	// The offset is negative if the image needs to be cropped.
+	offset := image.Pt((w-b.Dx())/2, (h-b.Dy())/2)
+	draw.Draw(dst, image.Rectangle{offset, offset.Add(b.Size())}, img, b.Min, draw.Over)
+	return dst, nil
+}
+
+// cropAround crops a `width` x `height` area centered on the focal point (`focalX`, `focalY`). Near the edges, the area is shifted so that it stays within the image, and the focal point is then off-center.
+// This is the manual override for the cases where `smartcrop` misjudges the subject - like the bird that I would have liked a bit more towards the center.
+func cropAround(img image.Image, focalX, focalY, width, height int) (image.Image, error) {
+	b := img.Bounds()
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("cropAround(): crop size must be positive")
+	}
+	if width > b.Dx() || height > b.Dy() {
+		return nil, errors.Errorf("cropAround(): crop size %dx%d exceeds image size %dx%d", width, height, b.Dx(), b.Dy())
+	}
+
+	x := clampInt(focalX-width/2, b.Min.X, b.Max.X-width)
+	y := clampInt(focalY-height/2, b.Min.Y, b.Max.Y-height)
+	return subImage(img, image.Rect(x, y, x+width, y+height)), nil
+}
+
+// centerRect returns a `width` x `height` rectangle centered within `bounds`. It fails if the rectangle does not fit.
+func centerRect(bounds image.Rectangle, width, height int) (image.Rectangle, error) {
+	if width <= 0 || height <= 0 {
+		return image.Rectangle{}, errors.New("centerRect(): crop size must be positive")
+	}
+	if width > bounds.Dx() || height > bounds.Dy() {
+		return image.Rectangle{}, errors.Errorf("centerRect(): crop size %dx%d exceeds image size %dx%d", width, height, bounds.Dx(), bounds.Dy())
+	}
+	topLeft := bounds.Min.Add(image.Pt((bounds.Dx()-width)/2, (bounds.Dy()-height)/2))
+	return image.Rectangle{topLeft, topLeft.Add(image.Pt(width, height))}, nil
+}
+
+// aspectSize returns the largest size with the ratio `wRatio:hRatio` that fits into `maxW` x `maxH`.
+func aspectSize(maxW, maxH, wRatio, hRatio int) (width, height int) {
+	// Try using the full width first. If the resulting height does not fit, use the full height instead.
+	width = maxW
+	height = maxW * hRatio / wRatio
+	if height > maxH {
+		height = maxH
+		width = maxH * wRatio / hRatio
+	}
+	return width, height
+}
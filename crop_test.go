@@ -0,0 +1,440 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestCropAspect(t *testing.T) {
+	img := grayGradient(400, 250)
+	for _, ratio := range [][2]int{{1, 1}, {16, 9}, {4, 3}} {
+		out, err := cropAspect(img, ratio[0], ratio[1], image.Rectangle{})
+		if err != nil {
+			t.Fatalf("cropAspect(%d:%d): %v", ratio[0], ratio[1], err)
+		}
+		b := out.Bounds()
+		got := float64(b.Dx()) / float64(b.Dy())
+		want := float64(ratio[0]) / float64(ratio[1])
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("cropAspect(%d:%d): got %dx%d (ratio %.3f), want ratio %.3f", ratio[0], ratio[1], b.Dx(), b.Dy(), got, want)
+		}
+		if b.Dx() > 400 || b.Dy() > 250 {
+			t.Errorf("cropAspect(%d:%d): %dx%d is larger than the input", ratio[0], ratio[1], b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestCropCopyIsIndependent(t *testing.T) {
+	img := colorGradient(80, 60)
+	orig := toRGBA(img)
+
+	c, err := cropCopy(img, 40, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, ok := c.(draw.Image)
+	if !ok {
+		t.Fatalf("cropCopy returned a %T, which cannot be drawn on", c)
+	}
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	if mae, err := compare(img, orig); err != nil || mae != 0 {
+		t.Errorf("drawing on the copy changed the original (difference %v, %v)", mae, err)
+	}
+}
+
+func TestCropSolidColor(t *testing.T) {
+	img := solidImage(300, 200, color.RGBA{90, 120, 150, 255})
+	out, err := crop(img, 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := out.Bounds()
+	if b.Empty() || !b.In(img.Bounds()) {
+		t.Errorf("got crop rectangle %v, want a non-empty rectangle within %v", b, img.Bounds())
+	}
+}
+
+func TestPad(t *testing.T) {
+	bg := color.RGBA{0, 0, 255, 255}
+	src := solidImage(40, 20, color.RGBA{255, 0, 0, 255})
+	out, err := pad(src, 60, 50, bg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := out.Bounds(); b.Dx() != 60 || b.Dy() != 50 {
+		t.Fatalf("got size %dx%d, want 60x50", b.Dx(), b.Dy())
+	}
+	// The source covers (10,15)-(50,35).
+	for _, p := range []image.Point{{0, 0}, {9, 25}, {50, 25}, {30, 14}, {30, 35}, {59, 49}} {
+		if got := out.At(p.X, p.Y); got != bg {
+			t.Errorf("pixel %v is %v, want the background", p, got)
+		}
+	}
+	for _, p := range []image.Point{{10, 15}, {30, 25}, {49, 34}} {
+		if got := out.At(p.X, p.Y); got != (color.RGBA{255, 0, 0, 255}) {
+			t.Errorf("pixel %v is %v, want the source", p, got)
+		}
+	}
+
+	if _, err := pad(src, 30, 50, bg, false); err == nil {
+		t.Error("canvas smaller than the image: want an error")
+	}
+}
+
+// twoRegions returns a gray image with a skin-colored square on the left and a fine checkerboard, which is all edges, on the right.
+func twoRegions() *image.RGBA {
+	img := solidImage(200, 100, color.RGBA{128, 128, 128, 255})
+	draw.Draw(img, image.Rect(20, 30, 60, 70), &image.Uniform{color.RGBA{224, 172, 140, 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(140, 30, 180, 70), checkerboard(40, 40, 2), image.Point{}, draw.Src)
+	return img
+}
+
+func TestCropWithOptionsWeights(t *testing.T) {
+	img := twoRegions()
+	plain, err := crop(img, 50, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := plain.Bounds().Size()
+	center := func(opts CropOptions) int {
+		t.Helper()
+		out, err := cropWithOptions(img, 50, 50, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The weights move the rectangle, but it keeps the size that crop picks.
+		b := out.Bounds()
+		if b.Size() != size {
+			t.Errorf("%+v: got size %v, want %v", opts, b.Size(), size)
+		}
+		return (b.Min.X + b.Max.X) / 2
+	}
+
+	if x := center(CropOptions{SkinWeight: 1}); x > 100 {
+		t.Errorf("skin weight only: crop centered at x=%d, want the skin-colored square on the left", x)
+	}
+	if x := center(CropOptions{EdgeWeight: 1}); x < 100 {
+		t.Errorf("edge weight only: crop centered at x=%d, want the checkerboard on the right", x)
+	}
+	if center(CropOptions{}) != center(defaultCropOptions) {
+		t.Error("zero weights do not act like the default weights")
+	}
+
+	if _, err := cropWithOptions(img, 50, 50, CropOptions{EdgeWeight: -1}); err == nil {
+		t.Error("negative weight: want an error")
+	}
+}
+
+func TestCropCandidates(t *testing.T) {
+	img := twoRegions()
+	e := computeEnergy(img, defaultEnergyWeights)
+	energy := func(r image.Rectangle) float64 {
+		sum := 0.0
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				sum += e.at(x, y)
+			}
+		}
+		return sum
+	}
+
+	rects, err := cropCandidates(img, 50, 50, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rects) == 0 || len(rects) > 3 {
+		t.Fatalf("got %d candidates, want 1 to 3", len(rects))
+	}
+	for i, r := range rects {
+		if r.Dx() != 50 || r.Dy() != 50 || !r.In(img.Bounds()) {
+			t.Errorf("candidate %d: %v is not a 50x50 rectangle within the image", i, r)
+		}
+		if i > 0 && energy(r) > energy(rects[i-1])+1e-6 {
+			t.Errorf("candidate %d scores higher than candidate %d", i, i-1)
+		}
+	}
+
+	if _, err := cropCandidates(img, 50, 50, 0); err == nil {
+		t.Error("n = 0: want an error")
+	}
+}
+
+func TestCropAroundClamps(t *testing.T) {
+	img := colorGradient(100, 80)
+	tests := []struct {
+		name           string
+		focalX, focalY int
+		wantX, wantY   int
+	}{
+		{"center", 50, 40, 35, 30},
+		{"top left corner", 0, 0, 0, 0},
+		{"bottom right corner", 99, 79, 70, 60},
+		{"outside", 500, -20, 70, 0},
+	}
+	for _, tt := range tests {
+		c, err := cropAround(img, tt.focalX, tt.focalY, 30, 20)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, want := c.Bounds(), image.Rect(tt.wantX, tt.wantY, tt.wantX+30, tt.wantY+20); got != want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, want)
+		}
+	}
+
+	if _, err := cropAround(img, 50, 40, 101, 20); err == nil {
+		t.Error("crop wider than the image: want an error")
+	}
+}
+
+func TestCropWithOptionsDefaultsMatchCrop(t *testing.T) {
+	img := twoRegions()
+	want, err := crop(img, 50, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Multiples of the default weights rank the windows alike, so they must pick crop's rectangle, too.
+	for name, opts := range map[string]CropOptions{
+		"zero value":      {},
+		"default options": defaultCropOptions,
+		"scaled defaults": {EdgeWeight: 0.4, SkinWeight: 3.6, SaturationWeight: 0.6},
+	} {
+		got, err := cropWithOptions(img, 50, 50, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Bounds() != want.Bounds() {
+			t.Errorf("%s: got %v, want crop's %v", name, got.Bounds(), want.Bounds())
+		}
+	}
+
+	// On this photo, the sliding window that custom weights use picks another rectangle than `crop`, so scaled defaults must not take that path.
+	photo, err := openImage("testdata/golden/input.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err = crop(photo, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cropWithOptions(photo, 1, 2, CropOptions{EdgeWeight: 0.4, SkinWeight: 3.6, SaturationWeight: 0.6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != want.Bounds() {
+		t.Errorf("photo with scaled defaults: got %v, want crop's %v", got.Bounds(), want.Bounds())
+	}
+}
+
+func TestCropWithOptionsPadding(t *testing.T) {
+	img := twoRegions()
+	tight, err := cropWithOptions(img, 50, 50, CropOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setting only the padding keeps the default weights, so the padded crop surrounds the tight one.
+	padded, err := cropWithOptions(img, 50, 50, CropOptions{Padding: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The square crop grows by a tenth of its size on each side, except where it touches the image edge.
+	if want := tight.Bounds().Inset(-tight.Bounds().Dx() / 10).Intersect(img.Bounds()); padded.Bounds() != want {
+		t.Errorf("10%% padding: got %v, want %v", padded.Bounds(), want)
+	}
+
+	// At the image edge, the padding is cut off.
+	corner, err := cropWithOptions(img, 200, 100, CropOptions{Padding: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corner.Bounds() != img.Bounds() {
+		t.Errorf("full-size crop with padding: got %v, want the image bounds %v", corner.Bounds(), img.Bounds())
+	}
+
+	if _, err := cropWithOptions(img, 50, 50, CropOptions{Padding: -0.1}); err == nil {
+		t.Error("negative padding: want an error")
+	}
+}
+
+func TestCropWithOptionsSafeZone(t *testing.T) {
+	img := twoRegions()
+	tight, err := cropWithOptions(img, 50, 50, CropOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting only the safe zone keeps the default weights, so a safe zone within the default crop changes nothing.
+	inside := image.Rect(0, 0, 10, 10).Add(tight.Bounds().Min.Add(image.Pt(20, 20)))
+	same, err := cropWithOptions(img, 50, 50, CropOptions{SafeZone: inside})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.Bounds() != tight.Bounds() {
+		t.Errorf("safe zone %v within the default crop: got %v, want %v", inside, same.Bounds(), tight.Bounds())
+	}
+
+	// A safe zone in the bottom-right corner pulls the crop there.
+	corner := image.Rect(185, 85, 200, 100)
+	out, err := cropWithOptions(img, 50, 50, CropOptions{SafeZone: corner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := out.Bounds(); b.Size() != tight.Bounds().Size() || !corner.In(b) || !b.In(img.Bounds()) {
+		t.Errorf("safe zone %v: got %v, want a crop of size %v within the image that contains it", corner, b, tight.Bounds().Size())
+	}
+
+	for _, sz := range []image.Rectangle{
+		image.Rect(10, 10, 120, 20),
+		image.Rect(190, 90, 210, 100),
+	} {
+		if _, err := cropWithOptions(img, 50, 50, CropOptions{SafeZone: sz}); err == nil {
+			t.Errorf("safe zone %v: want an error", sz)
+		}
+	}
+}
+
+func TestCropAspectSafeZone(t *testing.T) {
+	img := twoRegions()
+	plain, err := cropAspect(img, 1, 1, image.Rectangle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Put the safe zone at the edge farther away from smartcrop's choice, so that the crop has to move.
+	zone := image.Rect(185, 40, 200, 60)
+	if plain.Bounds().Min.X > 50 {
+		zone = image.Rect(0, 40, 15, 60)
+	}
+	out, err := cropAspect(img, 1, 1, zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := out.Bounds()
+	if b.Size() != plain.Bounds().Size() || !zone.In(b) || !b.In(img.Bounds()) {
+		t.Errorf("safe zone %v: got %v, want a crop of size %v within the image that contains it", zone, b, plain.Bounds().Size())
+	}
+
+	for _, sz := range []image.Rectangle{
+		image.Rect(10, 10, 160, 20),
+		image.Rect(190, 90, 210, 100),
+	} {
+		if _, err := cropAspect(img, 1, 1, sz); err == nil {
+			t.Errorf("safe zone %v: want an error", sz)
+		}
+	}
+}
+
+func TestCropPreview(t *testing.T) {
+	img := grayGradient(300, 200)
+	out, rect, err := cropPreview(img, 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rect.Dx() != rect.Dy() || !rect.In(img.Bounds()) || rect.Empty() {
+		t.Fatalf("got rectangle %v, want a square within %v", rect, img.Bounds())
+	}
+	if out.Bounds() != img.Bounds() {
+		t.Errorf("got bounds %v, want %v", out.Bounds(), img.Bounds())
+	}
+	// The outline lies on the inside of the rectangle; the area inside the outline is untouched.
+	for _, p := range []image.Point{rect.Min, {rect.Max.X - 1, rect.Min.Y}, {rect.Min.X, rect.Max.Y - 1}, {rect.Max.X - 1, rect.Max.Y - 1}, {(rect.Min.X + rect.Max.X) / 2, rect.Min.Y}} {
+		if got := out.At(p.X, p.Y); got != color.Color(guideColor) {
+			t.Errorf("outline pixel %v: got %v, want %v", p, got, guideColor)
+		}
+	}
+	if c := rect.Min.Add(rect.Max).Div(2); out.At(c.X, c.Y) != img.At(c.X, c.Y) {
+		t.Error("the center of the rectangle changed")
+	}
+}
+
+func TestCropSize(t *testing.T) {
+	img := grayGradient(300, 200)
+	for _, upscale := range []bool{false, true} {
+		out, err := cropSize(img, 90, 60, upscale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.Bounds().Size(); got != image.Pt(90, 60) {
+			t.Errorf("fitting size, upscale %v: got %v, want (90,60)", upscale, got)
+		}
+	}
+
+	// 400x400 does not fit, so without upscaling, the result is the largest square.
+	out, err := cropSize(img, 400, 400, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Bounds().Size(); got != image.Pt(200, 200) {
+		t.Errorf("oversized crop: got %v, want the largest square (200,200)", got)
+	}
+	out, err = cropSize(img, 400, 400, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Bounds().Size(); got != image.Pt(400, 400) {
+		t.Errorf("oversized crop with upscaling: got %v, want (400,400)", got)
+	}
+}
+
+func TestDrawGuides(t *testing.T) {
+	img := solidImage(300, 150, color.White)
+	out, err := drawGuides(img, GuideThirds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The thirds of 300x150 are at x=100 and x=200, y=50 and y=100.
+	for _, p := range []image.Point{{100, 10}, {200, 140}, {10, 50}, {290, 100}} {
+		if got := out.At(p.X, p.Y); got != color.Color(guideColor) {
+			t.Errorf("thirds: pixel %v is %v, want the guide color", p, got)
+		}
+	}
+	if got := out.At(150, 75); got != img.At(150, 75) {
+		t.Errorf("thirds: the center changed to %v", got)
+	}
+
+	out, err = drawGuides(img, GuideGoldenRatio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 38.2% of 300 is 115.
+	if got := out.At(115, 10); got != color.Color(guideColor) {
+		t.Errorf("golden ratio: pixel (115,10) is %v, want the guide color", got)
+	}
+	if got := out.At(100, 10); got != img.At(100, 10) {
+		t.Errorf("golden ratio: pixel (100,10) changed to %v", got)
+	}
+
+	if _, err := drawGuides(img, GuideType(7)); err == nil {
+		t.Error("unknown guide type: want an error")
+	}
+}
+
+func TestDrawCropRect(t *testing.T) {
+	img := solidImage(100, 80, color.White)
+	blue := color.RGBA{0, 0, 255, 255}
+	r := image.Rect(10, 20, 60, 70)
+	out := drawCropRect(img, r, blue)
+
+	for x := r.Min.X; x < r.Max.X; x++ {
+		for _, y := range []int{r.Min.Y, r.Max.Y - 1} {
+			if got := out.At(x, y); got != color.Color(blue) {
+				t.Fatalf("border pixel (%d,%d) is %v, want blue", x, y, got)
+			}
+		}
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for _, x := range []int{r.Min.X, r.Max.X - 1} {
+			if got := out.At(x, y); got != color.Color(blue) {
+				t.Fatalf("border pixel (%d,%d) is %v, want blue", x, y, got)
+			}
+		}
+	}
+	for _, p := range []image.Point{{r.Min.X - 1, r.Min.Y}, {r.Max.X, r.Max.Y - 1}, {35, 45}} {
+		if got := out.At(p.X, p.Y); got != img.At(p.X, p.Y) {
+			t.Errorf("pixel %v off the border changed to %v", p, got)
+		}
+	}
+}
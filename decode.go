@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+
+	// Register the GIF, PNG, and WebP decoders with `image.Decode`. (JPEG is registered through the main file.)
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/pkg/errors"
+)
+
+// decodeFS decodes the image `name` from the file system `fsys`. The format is detected automatically.
+// With an `embed.FS`, demos and tests can process images that are compiled into the binary, without touching the disk.
+func decodeFS(fsys fs.FS, name string) (image.Image, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open "+name)
+	}
+	defer f.Close()
+
+	img, _, err := decodeImage(f)
+	return img, err
+}
+
+// decodeDataURI decodes an image from a base64 data URI like "data:image/png;base64,iVBORw0...", as web apps use for inlined or pasted images. `placeholderDataURI` creates such URIs.
+// The MIME type must be an image type, but the actual format is detected from the data.
+func decodeDataURI(uri string) (image.Image, error) {
+	const prefix = "data:"
+	comma := strings.IndexByte(uri, ',')
+	if !strings.HasPrefix(uri, prefix) || comma < 0 {
+		return nil, errors.New("decodeDataURI(): not a data URI")
+	}
+	meta := uri[len(prefix):comma]
+	if !strings.HasSuffix(meta, ";base64") {
+		return nil, errors.New("decodeDataURI(): data URI is not base64-encoded")
+	}
+	if mime := strings.SplitN(meta, ";", 2)[0]; !strings.HasPrefix(mime, "image/") {
+		return nil, errors.Errorf("decodeDataURI(): MIME type %q is no image type", mime)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(uri[comma+1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeDataURI(): invalid base64 data")
+	}
+	img, _, err := decodeImage(bytes.NewReader(data))
+	return img, err
+}
+
+// verifyImage reads the complete image from `r` and checks that it is valid and not truncated. It returns a descriptive error otherwise.
+// Decoding alone is not enough: `jpeg.Decode` may happily return a partial image for a JPEG file that was cut off. Like `decodeImage`, verifyImage rejects images above `MaxPixels`.
+func verifyImage(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "verifyImage(): cannot read image data")
+	}
+	if len(data) == 0 {
+		return errors.New("verifyImage(): image data is empty")
+	}
+
+	_, format, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "verifyImage(): image is corrupt, truncated, or too large")
+	}
+	return checkComplete(data, format)
+}
+
+// MaxPixels is the largest number of pixels that `decodeImage` accepts. A small, malicious file can claim huge dimensions, and decoding it would exhaust the memory. The default of 100 megapixels leaves room for the largest camera images; set it to 0 to disable the check.
+var MaxPixels = 100 * 1000 * 1000
+
+// decodeImage decodes the image in `r` like `image.Decode`, but first checks the dimensions in the header against `MaxPixels`, so that an oversized image fails before any pixel memory is allocated.
+func decodeImage(r io.Reader) (image.Image, string, error) {
+	cfg, format, r, err := peekConfig(r)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "decodeImage()")
+	}
+	if err := checkMaxPixels(cfg); err != nil {
+		return nil, format, errors.Wrap(err, "decodeImage()")
+	}
+
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, format, errors.Wrap(err, "Decoding the image failed.")
+	}
+	return img, format, nil
+}
+
+// checkMaxPixels returns an error if an image of the size in `cfg` exceeds `MaxPixels`.
+func checkMaxPixels(cfg image.Config) error {
+	if MaxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > int64(MaxPixels) {
+		return errors.Errorf("image size %dx%d exceeds the limit of %d pixels", cfg.Width, cfg.Height, MaxPixels)
+	}
+	return nil
+}
+
+// imageInfo returns the size and the format of the image in `r` without decoding the pixels. Only the header is read, so this is cheap even for huge images, and a web upload handler can reject oversized images before decoding them.
+func imageInfo(r io.Reader) (width, height int, format string, err error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, "", errors.Wrap(err, "imageInfo(): unknown or corrupt image format")
+	}
+	return cfg.Width, cfg.Height, format, nil
+}
+
+// detectFormat finds out the format of the image data in `r` from its first bytes, no matter what the file extension claims. It returns the format name as registered with the `image` package ("jpeg", "png", "gif", "webp", and in builds with `-tags heic`, "heic") and a reader that yields the complete data, including the bytes that detectFormat had to read.
+func detectFormat(r io.Reader) (string, io.Reader, error) {
+	_, format, r, err := peekConfig(r)
+	if err != nil {
+		return "", r, errors.Wrap(err, "detectFormat()")
+	}
+	return format, r, nil
+}
+
+// peekConfig reads the header of the image data in `r` like `image.DecodeConfig`, and returns a reader that replays the complete data, including the header bytes, for decoding the image afterwards.
+func peekConfig(r io.Reader) (image.Config, string, io.Reader, error) {
+	var consumed bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(r, &consumed))
+	replay := io.MultiReader(&consumed, r)
+	if err != nil {
+		return image.Config{}, "", replay, errors.Wrap(err, "unknown or corrupt image format")
+	}
+	return cfg, format, replay, nil
+}
+
+// checkComplete checks already decoded image data for signs of truncation.
+// A complete JPEG file has an EOI (end of image) marker after its scans. The marker is not necessarily at the end of the file: Phones append data like Samsung's SEFT trailer, the video of a motion photo, or the further images of an MPF file. A GIF file must end with a trailer byte; some encoders append padding bytes, which are ignored. The PNG decoder already fails on a missing IEND chunk by itself.
+func checkComplete(data []byte, format string) error {
+	switch format {
+	case "jpeg":
+		// Skip the header segments first, as the EXIF thumbnail in the APP1 segment is a complete JPEG file of its own. Within the scan data, 0xff bytes are always followed by 0x00 or a restart marker, so the first EOI marker after the header ends the image.
+		segs, err := jpegHeaderSegments(bytes.NewReader(data))
+		if err != nil {
+			return errors.Wrap(err, "JPEG data is incomplete")
+		}
+		// Look up each segment instead of adding up their lengths, as fill bytes may precede the markers.
+		scan := 2
+		for _, seg := range segs {
+			scan += bytes.Index(data[scan:], seg) + len(seg)
+		}
+		if !bytes.Contains(data[scan:], []byte{0xff, 0xd9}) {
+			return errors.New("JPEG data has no end-of-image marker; the file is probably truncated")
+		}
+	case "gif":
+		if !bytes.HasSuffix(bytes.TrimRight(data, "\x00"), []byte{0x3b}) {
+			return errors.New("GIF data has no trailer; the file is probably truncated")
+		}
+	}
+	return nil
+}
+
+// isHEIC reports whether the data looks like a HEIC/HEIF file, as iPhones save them by default. Such files start with an `ftyp` box that names a HEIF brand.
+// There is no HEIF decoder in the standard library, and the available Go decoders depend on cgo. Builds with `-tags heic` include one (see heic.go); in all other builds, isHEIC at least lets `openImage` fail with a helpful message.
+func isHEIC(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	switch string(data[8:12]) {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+		return true
+	}
+	return false
+}
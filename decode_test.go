@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//go:embed testdata/tiny.png
+var testFS embed.FS
+
+func TestDecodeFS(t *testing.T) {
+	img, err := decodeFS(testFS, "testdata/tiny.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 3 {
+		t.Errorf("got size %dx%d, want 4x3", b.Dx(), b.Dy())
+	}
+	if got := color.NRGBAModel.Convert(img.At(1, 2)); got != (color.NRGBA{80, 240, 200, 255}) {
+		t.Errorf("pixel (1,2) is %v, want {80 240 200 255}", got)
+	}
+
+	if _, err := decodeFS(testFS, "testdata/missing.png"); err == nil {
+		t.Error("missing file: want an error")
+	}
+}
+
+// jpegBytes encodes the image as a JPEG and fails the test on errors.
+func jpegBytes(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyImage(t *testing.T) {
+	data := jpegBytes(t, colorGradient(64, 64))
+	if err := verifyImage(bytes.NewReader(data)); err != nil {
+		t.Errorf("complete JPEG: %v", err)
+	}
+
+	truncated := data[:len(data)*2/3]
+	if err := verifyImage(bytes.NewReader(truncated)); err == nil {
+		t.Error("truncated JPEG: want an error")
+	}
+
+	// Phones append trailers after the EOI marker.
+	trailer := append(append([]byte(nil), data...), []byte("SEFH\x00\x00\xff\xda\x01\x02SEFT")...)
+	if err := verifyImage(bytes.NewReader(trailer)); err != nil {
+		t.Errorf("JPEG with a trailer: %v", err)
+	}
+
+	// The EOI marker of an embedded thumbnail does not count.
+	thumb := jpegBytes(t, colorGradient(8, 8))
+	app1 := append([]byte{0xff, 0xe1, byte((len(thumb) + 2) >> 8), byte(len(thumb) + 2)}, thumb...)
+	withThumb, err := insertSegment(truncated, app1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkComplete(withThumb, "jpeg"); err == nil {
+		t.Error("truncated JPEG with a thumbnail: want an error")
+	}
+}
+
+func TestVerifyImageFillBytes(t *testing.T) {
+	data := jpegBytes(t, colorGradient(64, 64))
+	// Pad the first marker after SOI and the SOS marker with 0xff fill bytes, which JPEG allows before any marker.
+	sos := bytes.Index(data, []byte{0xff, 0xda})
+	padded := append([]byte(nil), data[:2]...)
+	padded = append(padded, 0xff, 0xff, 0xff)
+	padded = append(padded, data[2:sos]...)
+	padded = append(padded, 0xff, 0xff)
+	padded = append(padded, data[sos:]...)
+
+	if err := verifyImage(bytes.NewReader(padded)); err != nil {
+		t.Errorf("verifyImage: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "padded.jpg")
+	if err := os.WriteFile(path, padded, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := openImage(path)
+	if err != nil {
+		t.Fatalf("openImage: %v", err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(64, 64) {
+		t.Errorf("got size %v, want (64,64)", got)
+	}
+}
+
+// TestOpenHEICWithoutDecoder checks that builds without `-tags heic` recognize HEIC files and say how to get support for them. heic_test.go covers the decoding in builds with the tag.
+func TestOpenHEICWithoutDecoder(t *testing.T) {
+	if heicSupported {
+		t.Skip("built with -tags heic")
+	}
+	// A bare `ftyp` box with the "heic" brand is all that isHEIC looks at.
+	data := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	if !isHEIC(data) {
+		t.Fatal("isHEIC: got false, want true")
+	}
+	path := filepath.Join(t.TempDir(), "photo.heic")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := openImage(path)
+	if err == nil || !strings.Contains(err.Error(), "-tags heic") {
+		t.Errorf("openImage: got error %v, want a hint to rebuild with -tags heic", err)
+	}
+}
+
+func TestOpenImageIgnoresExtension(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/tiny.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tiny.jpg")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := openImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(1, 2)); got != (color.NRGBA{80, 240, 200, 255}) {
+		t.Errorf("pixel (1,2) is %v, want {80 240 200 255}", got)
+	}
+
+	format, r, err := detectFormat(bytes.NewReader(data))
+	if err != nil || format != "png" {
+		t.Fatalf("detectFormat: got %q, %v, want png", format, err)
+	}
+	// The returned reader replays the bytes that detectFormat consumed.
+	if replayed, _ := ioutil.ReadAll(r); !bytes.Equal(replayed, data) {
+		t.Error("detectFormat: the reader does not return the complete data")
+	}
+}
+
+// pngHeader returns the signature and the IHDR chunk of a w x h RGBA PNG file, without any pixel data.
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8], ihdr[9] = 8, 6 // 8 bits per channel, RGBA
+	chunk := append([]byte("IHDR"), ihdr...)
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestImageInfo(t *testing.T) {
+	// The header alone is enough; there are no pixels to decode.
+	w, h, format, err := imageInfo(bytes.NewReader(pngHeader(6000, 4000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 6000 || h != 4000 || format != "png" {
+		t.Errorf("got %dx%d %s, want 6000x4000 png", w, h, format)
+	}
+
+	if _, _, _, err := imageInfo(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("no image: want an error")
+	}
+}
+
+func TestDecodeImageMaxPixels(t *testing.T) {
+	// The header claims 100,000 x 100,000 pixels, which would take 40 GB.
+	huge := pngHeader(100000, 100000)
+	if _, _, err := decodeImage(bytes.NewReader(huge)); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("decodeImage: got error %v, want the size limit", err)
+	}
+	if err := verifyImage(bytes.NewReader(huge)); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("verifyImage: got error %v, want the size limit", err)
+	}
+}
+
+func TestDecodeDataURI(t *testing.T) {
+	// A single red pixel.
+	const uri = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8DwHwAFBQIAX8jx0gAAAABJRU5ErkJggg=="
+	img, err := decodeDataURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 1 || b.Dy() != 1 {
+		t.Errorf("got size %dx%d, want 1x1", b.Dx(), b.Dy())
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("got %v, want red", got)
+	}
+
+	for _, bad := range []string{
+		"image/png;base64,iVBORw0KGgo=",
+		"data:text/plain;base64,aGVsbG8=",
+		"data:image/png,rawdata",
+		"data:image/png;base64,!!!",
+	} {
+		if _, err := decodeDataURI(bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+
+	"github.com/anthonynsimon/bild/blur"
+	"github.com/anthonynsimon/bild/effect"
+	"github.com/pkg/errors"
+)
+
+// gaussianBlur softens the image with a Gaussian blur of the given radius.
+func gaussianBlur(img image.Image, radius float64) image.Image {
+	return blur.Gaussian(img, radius)
+}
+
+// dilate grows the bright areas of the image by `radius` pixels. On a thresholded image, this closes small gaps and holes.
+func dilate(img image.Image, radius int) (image.Image, error) {
+	if radius <= 0 {
+		return nil, errors.New("dilate(): radius must be positive")
+	}
+	return effect.Dilate(img, float64(radius)), nil
+}
+
+// erode shrinks the bright areas of the image by `radius` pixels. On a thresholded image, this removes isolated specks of noise.
+func erode(img image.Image, radius int) (image.Image, error) {
+	if radius <= 0 {
+		return nil, errors.New("erode(): radius must be positive")
+	}
+	return effect.Erode(img, float64(radius)), nil
+}
+
+// pixelate replaces each `blockSize` x `blockSize` block within `region` by the average color of the block, to make faces or license plates unrecognizable. The blocks start at the top-left corner of the region, and the blocks along the right and bottom edges are cut off at the region's border.
+// An empty region means the whole image. Pixels outside the region stay untouched.
+func pixelate(img image.Image, blockSize int, region image.Rectangle) (image.Image, error) {
+	if blockSize <= 0 {
+		return nil, errors.New("pixelate(): block size must be positive")
+	}
+	dst := toRGBA(img)
+	if region.Empty() {
+		region = dst.Bounds()
+	}
+	region = region.Intersect(dst.Bounds())
+
+	for by := region.Min.Y; by < region.Max.Y; by += blockSize {
+		for bx := region.Min.X; bx < region.Max.X; bx += blockSize {
+			block := image.Rect(bx, by, bx+blockSize, by+blockSize).Intersect(region)
+
+			// Average the premultiplied channels, so that transparent pixels do not darken the block.
+			var r, g, b, a uint64
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					c := dst.RGBAAt(x, y)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+				}
+			}
+			n := uint64(block.Dx() * block.Dy())
+			avg := color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)}
+			draw.Draw(dst, block, &image.Uniform{avg}, image.Point{}, draw.Src)
+		}
+	}
+	return dst, nil
+}
+
+// addNoise adds random noise to a copy of the image, for testing denoising filters or as a film grain effect. `kind` selects the noise:
+//
+// * "gaussian" adds normally distributed noise to each channel of each pixel. `amount` is the standard deviation, as a fraction of the full range, so 0.05 is a light grain.
+// * "saltpepper" turns the fraction `amount` of the pixels black or white, like dead pixels or dust.
+//
+// The same `seed` always produces the same noise, so tests are reproducible. The alpha channel stays as it is.
+func addNoise(img image.Image, kind string, amount float64, seed int64) (image.Image, error) {
+	if amount < 0 || amount > 1 {
+		return nil, errors.New("addNoise(): amount must be between 0 and 1")
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	var noise func(c color.NRGBA) color.NRGBA
+	switch kind {
+	case "gaussian":
+		jitter := func(v uint8) uint8 {
+			return uint8(math.Round(math.Max(0, math.Min(255, float64(v)+rng.NormFloat64()*amount*255))))
+		}
+		noise = func(c color.NRGBA) color.NRGBA {
+			return color.NRGBA{jitter(c.R), jitter(c.G), jitter(c.B), c.A}
+		}
+	case "saltpepper":
+		noise = func(c color.NRGBA) color.NRGBA {
+			if rng.Float64() >= amount {
+				return c
+			}
+			if rng.Intn(2) == 0 {
+				return color.NRGBA{0, 0, 0, c.A}
+			}
+			return color.NRGBA{255, 255, 255, c.A}
+		}
+	default:
+		return nil, errors.Errorf("addNoise(): unknown noise kind %q", kind)
+	}
+
+	// Walk through the pixels sequentially, so that the random numbers always go to the same pixels.
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.SetNRGBA(x, y, noise(color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)))
+		}
+	}
+	return dst, nil
+}
+
+// convolve applies a custom convolution kernel to the image. Sharpening, softening, embossing, and edge detection are all convolutions; they only differ in the kernel.
+// `kernel` is a list of rows with an odd number of rows and columns, so that it has a center pixel. The weighted sum of each channel is divided by `divisor` and then `offset` (on the 0-255 scale) is added; an emboss kernel, for example, sums up to 0 and needs an offset of 128 to map "no change" to mid gray. A `divisor` of 0 means the sum of the kernel weights, or 1 if the weights sum up to 0, which keeps the overall brightness of blur kernels.
+// Pixels beyond the image border repeat the nearest border pixel. The alpha channel stays as it is.
+func convolve(img image.Image, kernel [][]float64, divisor, offset float64) (image.Image, error) {
+	kh := len(kernel)
+	if kh%2 == 0 {
+		return nil, errors.New("convolve(): the kernel needs an odd number of rows")
+	}
+	kw := len(kernel[0])
+	for _, row := range kernel {
+		if len(row) != kw || kw%2 == 0 {
+			return nil, errors.New("convolve(): all kernel rows need the same, odd number of columns")
+		}
+	}
+	if divisor == 0 {
+		for _, row := range kernel {
+			for _, w := range row {
+				divisor += w
+			}
+		}
+		if divisor == 0 {
+			divisor = 1
+		}
+	}
+
+	b := img.Bounds()
+	src := image.NewNRGBA(b)
+	draw.Draw(src, b, img, b.Min, draw.Src)
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var sum [3]float64
+			for ky, row := range kernel {
+				sy := clampInt(y+ky-kh/2, b.Min.Y, b.Max.Y-1)
+				for kx, w := range row {
+					sx := clampInt(x+kx-kw/2, b.Min.X, b.Max.X-1)
+					i := src.PixOffset(sx, sy)
+					for c := 0; c < 3; c++ {
+						sum[c] += w * float64(src.Pix[i+c])
+					}
+				}
+			}
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				dst.Pix[i+c] = uint8(math.Round(math.Max(0, math.Min(255, sum[c]/divisor+offset))))
+			}
+			dst.Pix[i+3] = src.Pix[src.PixOffset(x, y)+3]
+		}
+	}
+	return dst, nil
+}
+
+// threshold converts the image to black and white. Pixels whose gray value is at least `level` become white, all others become black.
+// The gray value is the one of `color.GrayModel`, which `otsuThreshold` uses as well. (bild's `segment.Threshold` truncates its own gray values, which would turn a gray of exactly `level` black.)
+func threshold(img image.Image, level uint8) image.Image {
+	return binarize(toGray(img), level)
+}
+
+// otsuThreshold is like `threshold` but picks the level automatically, using Otsu's method.
+func otsuThreshold(img image.Image) image.Image {
+	gray := toGray(img)
+	return binarize(gray, otsuLevel(gray))
+}
+
+// toGray converts the image to an `image.Gray` through `color.GrayModel`.
+func toGray(img image.Image) *image.Gray {
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+	return gray
+}
+
+// binarize turns every pixel of `gray` that is at least `level` white and all others black.
+func binarize(gray *image.Gray, level uint8) *image.Gray {
+	dst := image.NewGray(gray.Bounds())
+	for i, v := range gray.Pix {
+		if v >= level {
+			dst.Pix[i] = 255
+		}
+	}
+	return dst
+}
+
+// otsuLevel finds the gray level that best separates the histogram of `gray` into two classes, by maximizing the variance between the classes.
+func otsuLevel(gray *image.Gray) uint8 {
+	var hist [256]int
+	b := gray.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			hist[gray.GrayAt(x, y).Y]++
+		}
+	}
+
+	total := b.Dx() * b.Dy()
+	sumAll := 0.0
+	for i, n := range hist {
+		sumAll += float64(i * n)
+	}
+
+	// Walk through all candidate levels, keeping running totals for the background class (everything below the level).
+	var best uint8
+	var bestVar, sumBg float64
+	weightBg := 0
+	for t := 0; t < 256; t++ {
+		weightBg += hist[t]
+		weightFg := total - weightBg
+		if weightBg == 0 {
+			continue
+		}
+		if weightFg == 0 {
+			break
+		}
+		sumBg += float64(t * hist[t])
+		meanBg := sumBg / float64(weightBg)
+		meanFg := (sumAll - sumBg) / float64(weightFg)
+		between := float64(weightBg) * float64(weightFg) * (meanBg - meanFg) * (meanBg - meanFg)
+		if between > bestVar {
+			bestVar = between
+			// Pixels up to t form the background, so the foreground starts at t+1.
+			best = uint8(t + 1)
+		}
+	}
+	return best
+}
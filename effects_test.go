@@ -0,0 +1,237 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"testing"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+// whiteSquare returns a black 40x40 image with a white 10x10 square in the middle.
+func whiteSquare() *image.RGBA {
+	img := solidImage(40, 40, color.Black)
+	draw.Draw(img, image.Rect(15, 15, 25, 25), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestDilateErode(t *testing.T) {
+	img := whiteSquare()
+	before := countBright(img)
+
+	grown, err := dilate(img, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countBright(grown); n <= before {
+		t.Errorf("dilate: %d white pixels, want more than %d", n, before)
+	}
+
+	shrunk, err := erode(img, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countBright(shrunk); n >= before || n == 0 {
+		t.Errorf("erode: %d white pixels, want fewer than %d but not none", n, before)
+	}
+
+	if _, err := dilate(img, 0); err == nil {
+		t.Error("dilate with radius 0: want an error")
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	out := threshold(grayGradient(256, 2), 128)
+	for x := 0; x < 256; x++ {
+		r, _, _, _ := out.At(x, 0).RGBA()
+		if want := x >= 128; (r > 0) != want {
+			t.Errorf("pixel %d: got %d, want white=%v", x, r>>8, want)
+		}
+	}
+}
+
+func TestOtsuThreshold(t *testing.T) {
+	// Dark gray on the left, light gray on the right.
+	img := solidImage(40, 20, color.Gray{60})
+	draw.Draw(img, image.Rect(20, 0, 40, 20), &image.Uniform{color.Gray{190}}, image.Point{}, draw.Src)
+
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), img, image.Point{}, draw.Src)
+	level := otsuLevel(gray)
+	if level <= 60 || level > 190 {
+		t.Errorf("otsuLevel: got %d, want a level between the two grays", level)
+	}
+	out := otsuThreshold(img)
+	if countBright(out) != 20*20 {
+		t.Errorf("otsuThreshold: %d white pixels, want the right half (400)", countBright(out))
+	}
+}
+
+func TestPixelate(t *testing.T) {
+	img := colorGradient(50, 40)
+	region := image.Rect(10, 5, 33, 30)
+	out, err := pixelate(img, 8, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The blocks start at the region's corner; the last ones are cut off at its edges.
+	for by := region.Min.Y; by < region.Max.Y; by += 8 {
+		for bx := region.Min.X; bx < region.Max.X; bx += 8 {
+			block := image.Rect(bx, by, bx+8, by+8).Intersect(region)
+			want := out.At(block.Min.X, block.Min.Y)
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					if got := out.At(x, y); got != want {
+						t.Fatalf("block %v: pixel (%d,%d) is %v, want %v", block, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !image.Pt(x, y).In(region) && out.At(x, y) != img.At(x, y) {
+				t.Fatalf("pixel (%d,%d) outside the region changed", x, y)
+			}
+		}
+	}
+
+	if _, err := pixelate(img, 0, region); err == nil {
+		t.Error("block size 0: want an error")
+	}
+}
+
+func TestAddNoise(t *testing.T) {
+	img := solidImage(100, 100, color.RGBA{128, 128, 128, 255})
+
+	out, err := addNoise(img, "saltpepper", 0.1, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := 0
+	b := out.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if c := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA); c.R != 128 {
+				changed++
+			}
+		}
+	}
+	if frac := float64(changed) / 10000; frac < 0.08 || frac > 0.12 {
+		t.Errorf("saltpepper 0.1: changed %.3f of the pixels, want about 0.1", frac)
+	}
+
+	again, _ := addNoise(img, "saltpepper", 0.1, 42)
+	if !samePixels(out, again) {
+		t.Error("the same seed produced different noise")
+	}
+	other, _ := addNoise(img, "saltpepper", 0.1, 43)
+	if samePixels(out, other) {
+		t.Error("different seeds produced the same noise")
+	}
+
+	if _, err := addNoise(img, "speckle", 0.1, 42); err == nil {
+		t.Error("unknown kind: want an error")
+	}
+}
+
+func TestConvolve(t *testing.T) {
+	img := colorGradient(16, 16)
+
+	identity := [][]float64{{0, 0, 0}, {0, 1, 0}, {0, 0, 0}}
+	out, err := convolve(img, identity, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(out, img) {
+		t.Error("identity kernel changed the image")
+	}
+
+	// A 3x3 box blur of a single white pixel on black spreads it to 255/9 over the 3x3 neighborhood.
+	dot := solidImage(5, 5, color.Black)
+	dot.Set(2, 2, color.White)
+	box := [][]float64{{1, 1, 1}, {1, 1, 1}, {1, 1, 1}}
+	out, err = convolve(dot, box, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			var want uint8
+			if x >= 1 && x <= 3 && y >= 1 && y <= 3 {
+				want = 28
+			}
+			if c := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA); c.R != want || c.A != 255 {
+				t.Errorf("box blur at (%d,%d): got %v, want gray %d", x, y, c, want)
+			}
+		}
+	}
+
+	for _, k := range [][][]float64{
+		{{1, 1}, {1, 1}},
+		{{1, 1}},
+		{{1, 1, 1}, {1, 1}, {1, 1, 1}},
+	} {
+		if _, err := convolve(img, k, 0, 0); err == nil {
+			t.Errorf("kernel %v: want an error", k)
+		}
+	}
+}
+
+var (
+	benchOnce sync.Once
+	benchImg  image.Image
+	benchErr  error
+)
+
+// benchImage loads the article's cropped photo once for all benchmarks, so that the benchmarks measure the effects and not the decoding. It also turns on the allocation report.
+func benchImage(b *testing.B) image.Image {
+	benchOnce.Do(func() {
+		benchImg, benchErr = openImage("cropped.jpg")
+	})
+	if benchErr != nil {
+		b.Fatal(benchErr)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	return benchImg
+}
+
+func BenchmarkSaturate(b *testing.B) {
+	img := benchImage(b)
+	for i := 0; i < b.N; i++ {
+		saturate(img)
+	}
+}
+
+func BenchmarkSharpen(b *testing.B) {
+	img := benchImage(b)
+	for i := 0; i < b.N; i++ {
+		sharpen(img)
+	}
+}
+
+func BenchmarkMultiply(b *testing.B) {
+	img := benchImage(b)
+	for i := 0; i < b.N; i++ {
+		multiply(img)
+	}
+}
+
+func BenchmarkGaussianBlur(b *testing.B) {
+	img := benchImage(b)
+	for i := 0; i < b.N; i++ {
+		gaussianBlur(img, 2)
+	}
+}
+
+func BenchmarkResizeFit(b *testing.B) {
+	img := benchImage(b)
+	for i := 0; i < b.N; i++ {
+		resizeFit(img, 640, 640, transform.Linear, false)
+	}
+}
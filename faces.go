@@ -0,0 +1,47 @@
+package main
+
+import (
+	"image"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/pkg/errors"
+)
+
+// FaceDetector finds faces in an image and returns their bounding boxes.
+//
+// The article mentions that smartcrop can use face recognition. That was `muesli/smartcrop` with OpenCV; `artyom/smartcrop` has no face detection at all. So instead of tying this package to a particular detector (and to cgo), `faceCrops` takes the detector as a parameter, for example one built on the pure-Go `esimov/pigo`.
+type FaceDetector interface {
+	DetectFaces(img image.Image) ([]image.Rectangle, error)
+}
+
+// faceCrops returns one square crop of `size` x `size` pixels per face that `detector` finds, for example for profile pictures. Each crop is centered on the face, with room for hair and shoulders, and shifted inwards near the image edges. If there are no faces, the result is an empty slice.
+func faceCrops(img image.Image, size int, detector FaceDetector) ([]image.Image, error) {
+	if size <= 0 {
+		return nil, errors.New("faceCrops(): size must be positive")
+	}
+	if detector == nil {
+		return nil, errors.New("faceCrops(): no face detector given")
+	}
+	faces, err := detector.DetectFaces(img)
+	if err != nil {
+		return nil, errors.Wrap(err, "Face detection failed")
+	}
+
+	b := img.Bounds()
+	crops := []image.Image{}
+	for _, f := range faces {
+		f = f.Intersect(b)
+		if f.Empty() {
+			continue
+		}
+		// The face takes up about half of the crop's width, as on a passport photo.
+		side := minInt(2*maxInt(f.Dx(), f.Dy()), minInt(b.Dx(), b.Dy()))
+		center := f.Min.Add(f.Size().Div(2))
+		c, err := cropAround(img, center.X, center.Y, side, side)
+		if err != nil {
+			return nil, err
+		}
+		crops = append(crops, transform.Resize(c, size, size, transform.Linear))
+	}
+	return crops, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// fakeDetector "detects" a fixed list of faces.
+type fakeDetector []image.Rectangle
+
+func (d fakeDetector) DetectFaces(img image.Image) ([]image.Rectangle, error) {
+	return d, nil
+}
+
+func TestFaceCrops(t *testing.T) {
+	img := colorGradient(200, 100)
+	faces := fakeDetector{image.Rect(20, 20, 50, 50), image.Rect(170, 60, 195, 95)}
+	crops, err := faceCrops(img, 64, faces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crops) != 2 {
+		t.Fatalf("got %d crops, want 2", len(crops))
+	}
+	for i, c := range crops {
+		if got := c.Bounds().Size(); got != image.Pt(64, 64) {
+			t.Errorf("crop %d: got size %v, want (64,64)", i, got)
+		}
+	}
+	// The second face is near the bottom right corner, so its crop shows mostly red and green.
+	r, g, _, _ := crops[1].At(32, 32).RGBA()
+	if r>>8 < 180 || g>>8 < 120 {
+		t.Errorf("second crop: center is %v, want the bottom right of the gradient", color.RGBAModel.Convert(crops[1].At(32, 32)))
+	}
+
+	crops, err = faceCrops(img, 64, fakeDetector{})
+	if err != nil || crops == nil || len(crops) != 0 {
+		t.Errorf("no faces: got %v, %v, want an empty slice", crops, err)
+	}
+	if _, err := faceCrops(img, 64, nil); err == nil {
+		t.Error("no detector: want an error")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// URLOptions controls how `openImageURL` fetches an image.
+type URLOptions struct {
+	// MaxRetries is the number of additional attempts after a failed download. Only transient failures are retried: network errors and 5xx server errors. A 4xx error like 404 or an image that cannot be decoded fails right away.
+	MaxRetries int
+	// Backoff is the wait time before the first retry. It doubles with each further retry.
+	Backoff time.Duration
+	// Client is the HTTP client to use. If nil, openImageURL uses `http.DefaultClient`.
+	Client *http.Client
+}
+
+// openImageURL downloads an image from `url` and decodes it. The format is detected automatically.
+// Canceling `ctx` aborts the download as well as the wait for the next retry.
+func openImageURL(ctx context.Context, url string, opts URLOptions) (image.Image, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var data []byte
+	var err error
+	wait := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		data, retry, err = fetch(ctx, client, url)
+		if err == nil || !retry || attempt >= opts.MaxRetries {
+			break
+		}
+		logger.Printf("openImageURL(): attempt %d failed, retrying in %v: %v", attempt+1, wait, err)
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "openImageURL(): canceled")
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, url)
+	}
+	return img, nil
+}
+
+// fetch downloads the content at `url`. If the download fails, `retry` tells whether the failure might be transient.
+func fetch(ctx context.Context, client *http.Client, url string) (data []byte, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "Invalid URL "+url)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// A canceled request is no transient failure.
+		return nil, ctx.Err() == nil, errors.Wrap(err, "Cannot fetch "+url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode >= 500, errors.Errorf("Cannot fetch %s: %s", url, resp.Status)
+	}
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ctx.Err() == nil, errors.Wrap(err, "Cannot read "+url)
+	}
+	return data, false, nil
+}
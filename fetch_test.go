@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer serves a JPEG image after answering the first `failures` requests with `status`. `requests` counts all requests.
+func flakyServer(t *testing.T, failures int32, status int, requests *int32) *httptest.Server {
+	data := jpegBytes(t, colorGradient(20, 10))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenImageURLRetries(t *testing.T) {
+	var requests int32
+	srv := flakyServer(t, 2, http.StatusServiceUnavailable, &requests)
+	img, err := openImageURL(context.Background(), srv.URL, URLOptions{MaxRetries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 20 || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("got a %v image after %d requests, want 20x10 after 3", img.Bounds().Size(), requests)
+	}
+
+	// Not enough retries.
+	requests = 0
+	srv = flakyServer(t, 2, http.StatusServiceUnavailable, &requests)
+	if _, err := openImageURL(context.Background(), srv.URL, URLOptions{MaxRetries: 1, Backoff: time.Millisecond}); err == nil || atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("one retry: got %v after %d requests, want an error after 2", err, requests)
+	}
+
+	// A 404 is final.
+	requests = 0
+	srv = flakyServer(t, 2, http.StatusNotFound, &requests)
+	if _, err := openImageURL(context.Background(), srv.URL, URLOptions{MaxRetries: 3, Backoff: time.Millisecond}); err == nil || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("404: got %v after %d requests, want an error after 1", err, requests)
+	}
+}
+
+func TestOpenImageURLCancel(t *testing.T) {
+	var requests int32
+	srv := flakyServer(t, 100, http.StatusInternalServerError, &requests)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The backoff is far longer than the test may take, so only the cancellation can end the wait.
+	start := time.Now()
+	_, err := openImageURL(ctx, srv.URL, URLOptions{MaxRetries: 5, Backoff: time.Hour})
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("returned after %v, want right after the cancellation", d)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
@@ -1,13 +1,16 @@
 module github.com/appliedgo/imageprocessing
 
-go 1.13
+go 1.16
 
 require (
 	github.com/anthonynsimon/bild v0.13.0
 	github.com/artyom/smartcrop v0.0.0-20151228104656-7a9cbb970c13
 	github.com/bamiaux/rez v0.0.0-20170731184118-29f4463c688b // indirect
+	github.com/chai2010/webp v1.4.0
 	github.com/fogleman/gg v1.3.0 // indirect
 	github.com/fogleman/primitive v0.0.0-20200504002142-0373c216458b
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/jdeng/goheif v0.0.0-20200323230657-a0d6a8b3e68f
 	github.com/pkg/errors v0.9.1
+	golang.org/x/image v0.18.0
 )
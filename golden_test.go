@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/pkg/errors"
+)
+
+// update makes `TestGolden` write its results to testdata/golden instead of comparing them. Run `go test -run TestGolden -update` after changing an effect on purpose, then review the new images before committing them.
+var update = flag.Bool("update", false, "write the golden images in testdata/golden instead of comparing against them")
+
+// goldenDir holds the input fixtures and the expected outputs of `TestGolden`.
+const goldenDir = "testdata/golden"
+
+// goldenTolerance is the largest difference per channel, on a scale from 0 to 255, that `TestGolden` accepts. The golden images are lossless PNGs, so only floating-point rounding on other platforms or in newer `bild` versions should cause differences.
+const goldenTolerance = 2
+
+// goldenInputs are the fixtures that every effect in `TestGolden` runs on. The JPEG decodes to a YCbCr image and the PNG to an RGBA image, so the effects are tested with both color models.
+var goldenInputs = []struct {
+	name, file string
+}{
+	{"jpeg", "input.jpg"},
+	{"png", "input.png"},
+}
+
+// goldenEffects lists the effects that `TestGolden` checks, with fixed parameters. The name is also the base name of the golden images.
+var goldenEffects = []struct {
+	name string
+	fn   func(img image.Image) (image.Image, error)
+}{
+	{"saturate", func(img image.Image) (image.Image, error) { return saturate(img), nil }},
+	{"multiply", func(img image.Image) (image.Image, error) { return multiply(img), nil }},
+	{"sharpen", func(img image.Image) (image.Image, error) { return sharpen(img), nil }},
+	{"exposure", func(img image.Image) (image.Image, error) { return exposure(img, 0.5), nil }},
+	{"gamma", func(img image.Image) (image.Image, error) { return gamma(img, 1.5), nil }},
+	{"brightness", func(img image.Image) (image.Image, error) { return brightness(img, 0.2), nil }},
+	{"contrast", func(img image.Image) (image.Image, error) { return contrast(img, 0.3), nil }},
+	{"levels", func(img image.Image) (image.Image, error) { return levels(img, 0.1, 0.9, 1.2, 0, 1) }},
+	{"curves", func(img image.Image) (image.Image, error) {
+		return curves(img, "rgb", []curvePoint{{0, 0}, {0.25, 0.2}, {0.75, 0.8}, {1, 1}})
+	}},
+	{"posterize", func(img image.Image) (image.Image, error) { return posterize(img, 4) }},
+	{"tint", func(img image.Image) (image.Image, error) { return tint(img, color.RGBA{112, 66, 20, 255}, 0.3), nil }},
+	{"autoWhiteBalance", func(img image.Image) (image.Image, error) { return autoWhiteBalance(img), nil }},
+	{"autoContrast", func(img image.Image) (image.Image, error) { return autoContrast(img), nil }},
+	{"autoEnhance", func(img image.Image) (image.Image, error) { return autoEnhance(img), nil }},
+	{"grayscaleWeighted", func(img image.Image) (image.Image, error) { return grayscaleWeighted(img, 0.2126, 0.7152, 0.0722), nil }},
+	{"toCMYK", func(img image.Image) (image.Image, error) { return toCMYK(img), nil }},
+	{"gaussianBlur", func(img image.Image) (image.Image, error) { return gaussianBlur(img, 2), nil }},
+	{"dilate", func(img image.Image) (image.Image, error) { return dilate(img, 1) }},
+	{"erode", func(img image.Image) (image.Image, error) { return erode(img, 1) }},
+	{"pixelate", func(img image.Image) (image.Image, error) { return pixelate(img, 6, image.Rectangle{}) }},
+	{"noiseGaussian", func(img image.Image) (image.Image, error) { return addNoise(img, "gaussian", 0.1, 1) }},
+	{"noiseSaltPepper", func(img image.Image) (image.Image, error) { return addNoise(img, "saltpepper", 0.05, 1) }},
+	{"emboss", func(img image.Image) (image.Image, error) {
+		return convolve(img, [][]float64{{-2, -1, 0}, {-1, 1, 1}, {0, 1, 2}}, 1, 0)
+	}},
+	{"threshold", func(img image.Image) (image.Image, error) { return threshold(img, 128), nil }},
+	{"otsuThreshold", func(img image.Image) (image.Image, error) { return otsuThreshold(img), nil }},
+	{"screen", func(img image.Image) (image.Image, error) { return screen(img, goldenOverlay(img)) }},
+	{"overlay", func(img image.Image) (image.Image, error) { return overlay(img, goldenOverlay(img)) }},
+	{"softLight", func(img image.Image) (image.Image, error) { return softLight(img, goldenOverlay(img)) }},
+	{"darken", func(img image.Image) (image.Image, error) { return darken(img, goldenOverlay(img)) }},
+	{"lighten", func(img image.Image) (image.Image, error) { return lighten(img, goldenOverlay(img)) }},
+	{"difference", func(img image.Image) (image.Image, error) { return difference(img, goldenOverlay(img)) }},
+	{"chromaKey", func(img image.Image) (image.Image, error) {
+		return chromaKey(img, color.RGBA{60, 120, 40, 255}, 0.2, 0.1), nil
+	}},
+	{"replaceColor", func(img image.Image) (image.Image, error) {
+		return replaceColor(img, color.RGBA{60, 120, 40, 255}, color.RGBA{200, 40, 160, 255}, 0.2, 0.1), nil
+	}},
+	{"setAlpha", func(img image.Image) (image.Image, error) { return setAlpha(img, 0.5) }},
+	{"invertColor", func(img image.Image) (image.Image, error) {
+		return mapPixels(img, func(x, y int, c color.Color) color.Color { return invertColor(c) }), nil
+	}},
+	{"quantize", func(img image.Image) (image.Image, error) {
+		q, _, err := quantize(img, 8)
+		return q, err
+	}},
+	{"rotate", func(img image.Image) (image.Image, error) { return rotate(img, 15), nil }},
+	{"rotate90", func(img image.Image) (image.Image, error) { return rotate90(img), nil }},
+	{"resizeFit", func(img image.Image) (image.Image, error) {
+		return resizeFit(img, 32, 32, transform.Linear, false), nil
+	}},
+	{"resizeThenSharpen", func(img image.Image) (image.Image, error) {
+		return resizeThenSharpen(img, 32, 24, 0.5, transform.Linear), nil
+	}},
+	{"placeholder", func(img image.Image) (image.Image, error) { return placeholder(img, 16, 12) }},
+	{"crop", func(img image.Image) (image.Image, error) { return crop(img, 32, 32) }},
+	{"seamCarve", func(img image.Image) (image.Image, error) { return seamCarve(img, 48, 40) }},
+	{"cropHeatmap", cropHeatmap},
+	{"drawGuides", func(img image.Image) (image.Image, error) { return drawGuides(img, GuideThirds) }},
+}
+
+// goldenOverlay returns the foreground layer for the blend modes in `TestGolden`: a color gradient of the same size as `img`.
+func goldenOverlay(img image.Image) image.Image {
+	return colorGradient(img.Bounds().Dx(), img.Bounds().Dy())
+}
+
+// TestGolden runs every effect in `goldenEffects` on the JPEG and the PNG fixture in testdata/golden and compares each result with the stored golden image `<effect>-<input>.png`. With `-update`, it writes the golden images instead.
+func TestGolden(t *testing.T) {
+	for _, in := range goldenInputs {
+		img, err := openImage(filepath.Join(goldenDir, in.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, eff := range goldenEffects {
+			name := eff.name + "-" + in.name
+			t.Run(name, func(t *testing.T) {
+				got, err := eff.fn(img)
+				if err != nil {
+					t.Fatal(err)
+				}
+				file := filepath.Join(goldenDir, name+".png")
+				if *update {
+					if err := writeGolden(file, got); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := openImage(file)
+				if err != nil {
+					t.Fatalf("%v (run `go test -run TestGolden -update` to create the golden image)", err)
+				}
+				delta, err := maxDelta(got, want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if delta > goldenTolerance {
+					t.Errorf("%s: a channel differs by %.1f, more than the tolerance of %v", file, delta, goldenTolerance)
+				}
+			})
+		}
+	}
+}
+
+// writeGolden saves `img` as a PNG file.
+func writeGolden(file string, img image.Image) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// maxDelta returns the largest difference of any channel of any pixel of `a` and `b`, on a scale from 0 to 255.
+func maxDelta(a, b image.Image) (float64, error) {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Dx() != bb.Dx() || ab.Dy() != bb.Dy() {
+		return 0, errors.Errorf("maxDelta(): image sizes differ (%dx%d vs %dx%d)", ab.Dx(), ab.Dy(), bb.Dx(), bb.Dy())
+	}
+	max := 0.0
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			for _, d := range []float64{absDiff(r1, r2), absDiff(g1, g2), absDiff(b1, b2), absDiff(a1, a2)} {
+				if d > max {
+					max = d
+				}
+			}
+		}
+	}
+	return max / 257, nil
+}
+
+// TestArticleImages runs the `bild` stages of `main` on the article's cropped image and compares the results with the article's images. The expected outputs are JPEGs, so the comparison uses the mean absolute error of `compare` and allows for JPEG artifacts. Regenerate the images by running the program if an effect changes on purpose.
+func TestArticleImages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("decodes and processes full-size photos")
+	}
+	img, err := openImage("cropped.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sat := saturate(img)
+
+	const tolerance = 4
+	tests := []struct {
+		golden string
+		got    image.Image
+	}{
+		{"saturated.jpg", sat},
+		{"multiplied.jpg", multiply(img)},
+		{"sharpened.jpg", sharpen(sat)},
+	}
+	for _, tt := range tests {
+		want, err := openImage(tt.golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mae, err := compare(tt.got, want)
+		if err != nil {
+			t.Errorf("%s: %v", tt.golden, err)
+			continue
+		}
+		if mae > tolerance {
+			t.Errorf("%s: mean absolute error %.2f exceeds the tolerance of %v", tt.golden, mae, tolerance)
+		}
+	}
+}
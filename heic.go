@@ -0,0 +1,11 @@
+//go:build heic
+// +build heic
+
+package main
+
+// Importing `jdeng/goheif` registers its HEIC decoder with the `image` package, so `decodeImage` reads HEIC files like any other format, including the `MaxPixels` check.
+// The package wraps the libde265 HEVC decoder via cgo, so this file is only built with `-tags heic`.
+import _ "github.com/jdeng/goheif"
+
+// heicSupported reports whether this build can decode HEIC files.
+const heicSupported = true
@@ -0,0 +1,23 @@
+//go:build heic
+// +build heic
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOpenHEIC(t *testing.T) {
+	// testdata/tiny.heic is a 64x48 HEIC file, red on the left half and blue on the right half.
+	img, err := openImage("testdata/tiny.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(64, 48) {
+		t.Fatalf("got size %v, want (64,48)", got)
+	}
+	assertColor(t, "left half", img, 10, 24, color.NRGBA{220, 40, 40, 255}, 12)
+	assertColor(t, "right half", img, 54, 24, color.NRGBA{40, 40, 220, 255}, 12)
+}
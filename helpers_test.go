@@ -0,0 +1,165 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// solidImage returns a w x h image filled with `c`.
+func solidImage(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return img
+}
+
+// grayGradient returns a w x h image that runs from black on the left to white on the right.
+func grayGradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / maxInt(w-1, 1))
+			img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// meanLuminance returns the average of the R, G, and B channels of all pixels, on a scale from 0 to 255.
+func meanLuminance(img image.Image) float64 {
+	b := img.Bounds()
+	sum := 0.0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			sum += float64(r+g+bl) / 3 / 257
+		}
+	}
+	return sum / float64(b.Dx()*b.Dy())
+}
+
+// countBright returns the number of pixels whose red channel is above mid gray.
+func countBright(img image.Image) int {
+	b := img.Bounds()
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r > 0x8000 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// colorGradient returns a w x h image whose red channel runs along x, green along y, and blue along the diagonal, so it contains many distinct colors.
+func colorGradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(x * 255 / maxInt(w-1, 1)),
+				uint8(y * 255 / maxInt(h-1, 1)),
+				uint8((x + y) * 255 / maxInt(w+h-2, 1)),
+				255,
+			})
+		}
+	}
+	return img
+}
+
+// gradient16 returns a w x 1 16-bit gray gradient from black to white.
+func gradient16(w int) *image.NRGBA64 {
+	img := image.NewNRGBA64(image.Rect(0, 0, w, 1))
+	for x := 0; x < w; x++ {
+		v := uint16(x * 0xffff / (w - 1))
+		img.SetNRGBA64(x, 0, color.NRGBA64{v, v, v, 0xffff})
+	}
+	return img
+}
+
+// distinctLevels returns the number of distinct values of the red channel in the image, at 16 bits. The fewer levels a smooth gradient has, the more visible the banding.
+func distinctLevels(img image.Image) int {
+	seen := map[uint32]bool{}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			seen[r] = true
+		}
+	}
+	return len(seen)
+}
+
+// checkerboard returns a w x h black-and-white checkerboard with square cells of `cell` pixels.
+func checkerboard(w, h, cell int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x/cell+y/cell)%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+// lumRange returns the darkest and the brightest gray value of the image.
+func lumRange(img image.Image) (lo, hi uint8) {
+	lo = 255
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+	}
+	return lo, hi
+}
+
+// samePixels reports whether both images have the same size and the same colors, ignoring where their bounds start.
+func samePixels(a, b image.Image) bool {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Size() != bb.Size() {
+		return false
+	}
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// channelMeans returns the average of the R, G, and B channels, on a scale from 0 to 255.
+func channelMeans(img image.Image) [3]float64 {
+	var sum [3]float64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			sum[0] += float64(r) / 257
+			sum[1] += float64(g) / 257
+			sum[2] += float64(bl) / 257
+		}
+	}
+	n := float64(b.Dx() * b.Dy())
+	return [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+}
+
+// spread returns the difference between the largest and the smallest of the values.
+func spread(v [3]float64) float64 {
+	return math.Max(v[0], math.Max(v[1], v[2])) - math.Min(v[0], math.Min(v[1], v[2]))
+}
@@ -56,8 +56,9 @@ package main
 import (
 	// basic image handling
 	"image"
-	// The `jpeg` package decodes and encodes JPG images.
-	"image/jpeg"
+	"image/color"
+	// Importing the `jpeg` package registers its JPG decoder with `image.Decode`.
+	_ "image/jpeg"
 
 	// The third-party libraries used here.
 	"github.com/anthonynsimon/bild/adjust"
@@ -69,12 +70,11 @@ import (
 	"github.com/pkg/errors"
 
 	//...and the rest.
-	"fmt"
+	"bytes"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
-	"path"
-	"runtime"
 	"time"
 )
 
@@ -98,29 +98,42 @@ func openImage(path string) (image.Image, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Cannot open "+path)
 	}
+	defer imgFile.Close()
 
-	// Decode from JPG into image.Image format.
-	img, err := jpeg.Decode(imgFile)
+	// Read the whole file first, so that we can check it for completeness after decoding.
+	data, err := ioutil.ReadAll(imgFile)
 	if err != nil {
-		return nil, errors.Wrap(err, "Decoding the image failed.")
+		return nil, errors.Wrap(err, "Cannot read "+path)
 	}
 
-	return img, nil
-}
-
-// saveImage saves the image to `pname/fname.jpg`.
-func saveImage(img image.Image, pname, fname string) error {
-	fpath := path.Join(pname, fname)
+	if isHEIC(data) && !heicSupported {
+		return nil, errors.New(path + " is a HEIC file, which this build does not support. Rebuild with -tags heic, or convert it to JPEG first.")
+	}
 
-	f, err := os.Create(fpath)
+	// Decode from JPG (or PNG, or GIF) into image.Image format. File extensions can lie, so `decodeImage` looks at the data to find out the format. It also refuses images that are too large to fit into memory.
+	img, format, err := decodeImage(bytes.NewReader(data))
 	if err != nil {
-		return errors.Wrap(err, "Cannot create file: "+fpath)
+		return nil, errors.Wrap(err, path)
 	}
-	err = jpeg.Encode(f, img, &jpeg.Options{Quality: 85})
+
+	// A half-downloaded file might still decode to a partial image. Let's make sure it fails loudly instead.
+	err = checkComplete(data, format)
 	if err != nil {
-		return errors.Wrap(err, "Failed to encode the image as JPEG")
+		return nil, errors.Wrap(err, path)
 	}
-	return nil
+
+	// JPEG files from print workflows are often CMYK. They decode fine, but `bild` and the other steps below expect RGB, so let's convert them right here. (See `toRGB` for how exact the conversion is.)
+	if isCMYK(img) {
+		logger.Printf("%s is a CMYK image, converting it to RGB", path)
+		img = toRGB(img)
+	}
+
+	return img, nil
+}
+
+// saveImage saves the image to `pname/fname`. The format depends on the file extension; usually, this is JPEG.
+func saveImage(img image.Image, pname, fname string) error {
+	return saveImageAs(img, pname, fname, defaultSaveOptions)
 }
 
 /*
@@ -154,6 +167,15 @@ func crop(img image.Image, width, height int) (image.Image, error) {
 		return nil, errors.Wrap(err, "Smartcrop failed")
 	}
 
+	// On nearly uniform images, smartcrop can come up with a rectangle that is empty or lies outside the image. Let's clip it to the image, and if nothing is left, fall back to a centered crop.
+	rect = rect.Intersect(img.Bounds())
+	if rect.Empty() {
+		rect, err = centerRect(img.Bounds(), width, height)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Now let's crop the image to the suggested area.
 	// First, we need to apply the aforementioned type assertion.
 	si, ok := (img).(SubImager)
@@ -241,31 +263,29 @@ This package comes as a binary package; however, it is well structured and inclu
 */
 
 //Making art.
-func primitivePicture(img image.Image) image.Image {
-
-	// Resize the image to 256x256 to save processing time.
-	// `transform` is a `bild` package.
-
-	img = transform.Resize(img, 256, 256, transform.Linear)
+func primitivePicture(img image.Image, filter transform.ResampleFilter, background color.Color) image.Image {
 
 	// Seed random number generator.
 	rand.Seed(time.Now().UTC().UnixNano())
 
-	// Set the background color.
-	bg := primitive.MakeColor(primitive.AverageImageColor(img))
+	// Resize the image and set up the model with the background color. `newPrimitiveModel` (see primitive.go) does this for `primitiveUntil`, too.
+	model := newPrimitiveModel(img, filter, background)
 
-	// NewModel(image, background color, output size, # of workers)
-	model := primitive.NewModel(img, bg, 1024, runtime.NumCPU())
+	addShapes(model, 100)
+	return model.Context.Image()
+}
 
-	for i := 0; i < 100; i++ {
+// addShapes adds `n` shapes to the model, each one chosen to bring the picture closest to the original.
+func addShapes(model *primitive.Model, n int) {
+	logger.Printf("primitive: adding %d shapes", n)
+	start := time.Now()
+	for i := 0; i < n; i++ {
 		// 5 = rotated rectangles,
 		// 128 = default alpha,
 		// 0 = default repeat
-		fmt.Print(".")
 		model.Step(primitive.ShapeType(5), 128, 0)
 	}
-
-	return model.Context.Image()
+	logger.Printf("primitive: done after %v, score %.4f", time.Since(start), model.Score)
 }
 
 /*
@@ -292,6 +312,8 @@ Last not least, the `main` function connects all the code snippets.
 
 // main
 func main() {
+	logger = log.New(os.Stderr, "", log.LstdFlags)
+
 	img, err := openImage("original.jpg")
 	if err != nil {
 		log.Fatal(err)
@@ -335,7 +357,7 @@ func main() {
 	}
 
 	// Create "primitive" art.
-	pri := primitivePicture(sat)
+	pri := primitivePicture(sat, transform.Linear, nil)
 	err = saveImage(pri, ".", "primitive.jpg")
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,72 @@
+package jpegdec
+
+import "math"
+
+// blockPixels returns the width and height of the pixels that each 8x8 block
+// of coefficients yields at the decoder's scale.
+func (d *decoder) blockPixels() int {
+	if d.scale == 0 {
+		return 8
+	}
+	return 8 / d.scale
+}
+
+// idctWeights[n][x][u] is the weight of the coefficient u for the output
+// pixel x of a 1D inverse DCT that yields n instead of 8 pixels, for n = 1,
+// 2, and 4.
+//
+// The coefficients of an 8x8 block are those of an orthonormal 2D DCT. Each
+// of the n output pixels stands for 8/n pixels of the full block, and its
+// weights are the averages of the orthonormal 8-point basis functions over
+// these pixels. The output is therefore the box-filtered full-size block,
+// without computing the full-size block first. For n = 1, only the DC
+// coefficient has a weight, and the pixel is the DC coefficient divided by 8.
+var idctWeights [5][4][8]float64
+
+func init() {
+	for _, n := range []int{1, 2, 4} {
+		group := 8 / n
+		for x := 0; x < n; x++ {
+			for u := 0; u < 8; u++ {
+				alpha := math.Sqrt(2.0 / 8)
+				if u == 0 {
+					alpha = math.Sqrt(1.0 / 8)
+				}
+				sum := 0.0
+				for p := x * group; p < (x+1)*group; p++ {
+					sum += math.Cos(float64((2*p+1)*u) * math.Pi / 16)
+				}
+				idctWeights[n][x][u] = alpha * sum / float64(group)
+			}
+		}
+	}
+}
+
+// idctScaled implements an inverse DCT of b that yields n x n pixels, for
+// n = 1, 2, or 4, each the average of (8/n) x (8/n) pixels of the full
+// inverse DCT. The input is the dequantized block in natural order. The
+// output goes to the top-left n x n values of b, with the same level shift
+// as that of idct.
+func idctScaled(b *block, n int) {
+	w := &idctWeights[n]
+	// Transform the rows first, then the columns.
+	var rows [8][4]float64
+	for v := 0; v < 8; v++ {
+		for x := 0; x < n; x++ {
+			sum := 0.0
+			for u := 0; u < 8; u++ {
+				sum += w[x][u] * float64(b[8*v+u])
+			}
+			rows[v][x] = sum
+		}
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			sum := 0.0
+			for v := 0; v < 8; v++ {
+				sum += w[y][v] * rows[v][x]
+			}
+			b[8*y+x] = int32(math.Round(sum))
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package jpegdec
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/appliedgo/imageprocessing/internal/jpegenc"
+)
+
+// testImage returns a w x h image with gradients, waves, and a fine checkerboard, which has the highest frequencies that a block can hold. If gray is true, the image has no color.
+func testImage(w, h int, gray bool) image.Image {
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	g := image.NewGray(rgba.Bounds())
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			r := 128 + 100*math.Sin(2*math.Pi*fx)*math.Cos(math.Pi*fy)
+			gr := 20 + 180*fy + 30*float64((x^y)&1)
+			b := 128 + 90*math.Cos(3*math.Pi*(fx+fy)/2)
+			rgba.SetRGBA(x, y, color.RGBA{uint8(r), uint8(gr), uint8(b), 255})
+			g.SetGray(x, y, color.Gray{uint8((r + gr + b) / 3)})
+		}
+	}
+	if gray {
+		return g
+	}
+	return rgba
+}
+
+// testInputs are JPEG files of every kind that the decoder handles differently.
+func testInputs(t *testing.T, w, h int) map[string][]byte {
+	t.Helper()
+	opts := map[string]struct {
+		gray bool
+		o    jpegenc.Options
+	}{
+		"gray":        {true, jpegenc.Options{Quality: 90}},
+		"420":         {false, jpegenc.Options{Quality: 90, Subsampling: jpegenc.Subsampling420}},
+		"422":         {false, jpegenc.Options{Quality: 90, Subsampling: jpegenc.Subsampling422}},
+		"444":         {false, jpegenc.Options{Quality: 90, Subsampling: jpegenc.Subsampling444}},
+		"progressive": {false, jpegenc.Options{Quality: 90, Progressive: true}},
+	}
+	inputs := map[string][]byte{}
+	for name, tt := range opts {
+		var buf bytes.Buffer
+		o := tt.o
+		if err := jpegenc.Encode(&buf, testImage(w, h, tt.gray), &o); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		inputs[name] = buf.Bytes()
+	}
+	return inputs
+}
+
+// boxDownscale returns the average of each scale x scale block of the samples of p, a w x h plane with the given stride. Blocks at the right and bottom edges may be smaller.
+func boxDownscale(p []uint8, stride, w, h, scale int) []uint8 {
+	sw, sh := (w+scale-1)/scale, (h+scale-1)/scale
+	out := make([]uint8, sw*sh)
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			sum, n := 0, 0
+			for sy := y * scale; sy < (y+1)*scale && sy < h; sy++ {
+				for sx := x * scale; sx < (x+1)*scale && sx < w; sx++ {
+					sum += int(p[sy*stride+sx])
+					n++
+				}
+			}
+			out[y*sw+x] = uint8((sum + n/2) / n)
+		}
+	}
+	return out
+}
+
+// plane is one channel of samples of a decoded image.
+type plane struct {
+	pix          []uint8
+	stride, w, h int
+}
+
+// planes returns the sample planes of a decoded image: the gray plane, or the Y, Cb, and Cr planes.
+func planes(t *testing.T, img image.Image) []plane {
+	t.Helper()
+	switch m := img.(type) {
+	case *image.Gray:
+		return []plane{{m.Pix[m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y):], m.Stride, m.Rect.Dx(), m.Rect.Dy()}}
+	case *image.YCbCr:
+		// The chroma planes cover the image with half or all of its resolution, depending on the subsampling.
+		cw, ch := m.Rect.Dx(), m.Rect.Dy()
+		switch m.SubsampleRatio {
+		case image.YCbCrSubsampleRatio420:
+			cw, ch = (cw+1)/2, (ch+1)/2
+		case image.YCbCrSubsampleRatio422:
+			cw = (cw + 1) / 2
+		}
+		return []plane{
+			{m.Y[m.YOffset(m.Rect.Min.X, m.Rect.Min.Y):], m.YStride, m.Rect.Dx(), m.Rect.Dy()},
+			{m.Cb[m.COffset(m.Rect.Min.X, m.Rect.Min.Y):], m.CStride, cw, ch},
+			{m.Cr[m.COffset(m.Rect.Min.X, m.Rect.Min.Y):], m.CStride, cw, ch},
+		}
+	}
+	t.Fatalf("unexpected image type %T", img)
+	return nil
+}
+
+// maxDiff returns the largest difference between the samples of p and the w x h samples of want.
+func maxDiff(p plane, want []uint8) int {
+	max := 0
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			d := int(p.pix[y*p.stride+x]) - int(want[y*p.w+x])
+			if d < 0 {
+				d = -d
+			}
+			if d > max {
+				max = d
+			}
+		}
+	}
+	return max
+}
+
+func TestDecodeScaledFullSize(t *testing.T) {
+	// Scale 1 must decode exactly like the standard library, including odd sizes with partial blocks.
+	for name, data := range testInputs(t, 37, 23) {
+		want, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := DecodeScaled(bytes.NewReader(data), 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the image differs from the one that image/jpeg decodes", name)
+		}
+	}
+}
+
+func TestDecodeScaled(t *testing.T) {
+	// The scaled decoding keeps the chroma subsampling, so each plane is compared with the box downscaled plane of the full-size image. Only rounding may differ.
+	const tolerance = 1
+	for name, data := range testInputs(t, 96, 64) {
+		full, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		fullPlanes := planes(t, full)
+		for _, scale := range []int{2, 4, 8} {
+			got, err := DecodeScaled(bytes.NewReader(data), scale)
+			if err != nil {
+				t.Fatalf("%s, scale %d: %v", name, scale, err)
+			}
+			if want := image.Rect(0, 0, 96/scale, 64/scale); got.Bounds() != want {
+				t.Fatalf("%s, scale %d: got bounds %v, want %v", name, scale, got.Bounds(), want)
+			}
+			if got.ColorModel() != full.ColorModel() {
+				t.Errorf("%s, scale %d: got a different color model than at full size", name, scale)
+			}
+			for i, p := range planes(t, got) {
+				f := fullPlanes[i]
+				want := boxDownscale(f.pix, f.stride, f.w, f.h, scale)
+				if d := maxDiff(p, want); d > tolerance {
+					t.Errorf("%s, scale %d, plane %d: a sample differs by %d from the box downscaled full-size image, want at most %d", name, scale, i, d, tolerance)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeScaledSize(t *testing.T) {
+	data := testInputs(t, 37, 23)["420"]
+	for scale, want := range map[int]image.Rectangle{2: image.Rect(0, 0, 19, 12), 4: image.Rect(0, 0, 10, 6), 8: image.Rect(0, 0, 5, 3)} {
+		got, err := DecodeScaled(bytes.NewReader(data), scale)
+		if err != nil {
+			t.Fatalf("scale %d: %v", scale, err)
+		}
+		if got.Bounds() != want {
+			t.Errorf("scale %d: got bounds %v, want %v", scale, got.Bounds(), want)
+		}
+	}
+	if _, err := DecodeScaled(bytes.NewReader(data), 3); err == nil {
+		t.Error("scale 3: want an error")
+	}
+}
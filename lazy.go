@@ -0,0 +1,50 @@
+package main
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/anthonynsimon/bild/parallel"
+)
+
+// LazyImage is an `image.Image` that applies `Fn` to the pixels of `Src` only when they are read.
+// Wrapping one LazyImage in another chains per-pixel effects like inverting, brightening, or tinting without allocating an intermediate image for each step. Spatial effects like blurring or sharpening need the neighboring pixels, however, and cannot be applied lazily.
+//
+// Each call to `At` recomputes the pixel. If the pixels are read more than once, it is cheaper to materialize the result, for example with `toRGBA`.
+type LazyImage struct {
+	Src image.Image
+	Fn  func(color.Color) color.Color
+}
+
+func (l *LazyImage) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+func (l *LazyImage) Bounds() image.Rectangle {
+	return l.Src.Bounds()
+}
+
+func (l *LazyImage) At(x, y int) color.Color {
+	return color.RGBA64Model.Convert(l.Fn(l.Src.At(x, y)))
+}
+
+// invertColor inverts the RGB channels of a color and keeps its alpha. It can be used as a `LazyImage` function.
+func invertColor(c color.Color) color.Color {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return color.NRGBA64{0xffff - n.R, 0xffff - n.G, 0xffff - n.B, n.A}
+}
+
+// mapPixels is an escape hatch for effects that `bild` does not provide: It calls `fn` for every pixel and builds a new image from the returned colors.
+// The rows are processed in parallel, so `fn` must be safe for concurrent use. It should compute each pixel from its arguments alone, without keeping state between calls.
+func mapPixels(img image.Image, fn func(x, y int, c color.Color) color.Color) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	parallel.Line(b.Dy(), func(start, end int) {
+		for y := b.Min.Y + start; y < b.Min.Y+end; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				dst.Set(x, y, fn(x, y, img.At(x, y)))
+			}
+		}
+	})
+	return dst
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/anthonynsimon/bild/effect"
+)
+
+func TestLazyImageInvert(t *testing.T) {
+	img := colorGradient(30, 20)
+	lazy := &LazyImage{Src: img, Fn: invertColor}
+	if mae, err := compare(lazy, effect.Invert(img)); err != nil || mae != 0 {
+		t.Errorf("lazy and eager invert differ: %v, %v", mae, err)
+	}
+
+	// Inverting twice yields the original.
+	twice := &LazyImage{Src: lazy, Fn: invertColor}
+	if mae, err := compare(twice, img); err != nil || mae != 0 {
+		t.Errorf("double invert differs from the original: %v, %v", mae, err)
+	}
+}
+
+func TestMapPixelsChannelSwap(t *testing.T) {
+	img := colorGradient(30, 20)
+	swapped := mapPixels(img, func(x, y int, c color.Color) color.Color {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		return color.NRGBA{n.B, n.G, n.R, n.A}
+	})
+	for _, p := range [][2]int{{0, 0}, {29, 0}, {13, 17}} {
+		want := img.RGBAAt(p[0], p[1])
+		got := color.RGBAModel.Convert(swapped.At(p[0], p[1])).(color.RGBA)
+		if got.R != want.B || got.G != want.G || got.B != want.R {
+			t.Errorf("pixel %v: got %v, want R and B of %v swapped", p, got, want)
+		}
+	}
+}
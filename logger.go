@@ -0,0 +1,14 @@
+package main
+
+// Logger receives progress and diagnostic messages. `*log.Logger` from the standard library satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logger is where the functions of this package send their messages. It discards everything by default, so that embedding applications stay quiet unless they set it; `main` sets it to a standard logger.
+var logger Logger = nopLogger{}
+
+// nopLogger is a Logger that discards all messages.
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger is a Logger that records all messages.
+type captureLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+// captureLog replaces the package logger by a captureLogger until the test ends.
+func captureLog(t *testing.T) *captureLogger {
+	l := &captureLogger{}
+	old := logger
+	logger = l
+	t.Cleanup(func() { logger = old })
+	return l
+}
+
+func TestLogger(t *testing.T) {
+	log := captureLog(t)
+	if _, err := openImage("testdata/cmyk.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.messages) != 1 || !strings.Contains(log.messages[0], "CMYK") {
+		t.Errorf("got messages %q, want one about the CMYK conversion", log.messages)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// readExif returns the raw EXIF segment (APP1) of the JPEG file at `path`, including its marker and length bytes, or nil if the file has no EXIF data.
+// Re-encoding an image drops all metadata. Passing the segment to `saveImageAs` via `SaveOptions.Exif` carries the camera, lens, exposure, and date fields over to the processed file (see `rewriteExif`).
+func readExif(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open "+path)
+	}
+	defer f.Close()
+
+	segs, err := jpegHeaderSegments(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "readExif()")
+	}
+	for _, seg := range segs {
+		if seg[1] == 0xe1 && bytes.HasPrefix(seg[4:], []byte("Exif\x00\x00")) {
+			return seg, nil
+		}
+	}
+	return nil, nil
+}
+
+// exifHeader starts the payload of the APP1 segment that holds the EXIF data. A TIFF structure follows.
+const exifHeader = "Exif\x00\x00"
+
+// EXIF tags that `rewriteExif` handles specially.
+const (
+	tagOrientation     = 0x0112
+	tagExifIFD         = 0x8769
+	tagPixelXDimension = 0xa002
+	tagPixelYDimension = 0xa003
+)
+
+// ifd0Tags are the tags of the main directory (IFD0) that `rewriteExif` keeps: camera, software, date, author, and resolution.
+var ifd0Tags = map[uint16]bool{
+	0x010f: true, // Make
+	0x0110: true, // Model
+	0x011a: true, // XResolution
+	0x011b: true, // YResolution
+	0x0128: true, // ResolutionUnit
+	0x0131: true, // Software
+	0x0132: true, // DateTime
+	0x013b: true, // Artist
+	0x8298: true, // Copyright
+}
+
+// exifIFDTags are the tags of the EXIF directory that `rewriteExif` keeps: exposure, lens, and dates.
+var exifIFDTags = map[uint16]bool{
+	0x829a: true, // ExposureTime
+	0x829d: true, // FNumber
+	0x8822: true, // ExposureProgram
+	0x8827: true, // ISOSpeedRatings
+	0x9000: true, // ExifVersion
+	0x9003: true, // DateTimeOriginal
+	0x9004: true, // DateTimeDigitized
+	0x9010: true, // OffsetTime
+	0x9011: true, // OffsetTimeOriginal
+	0x9012: true, // OffsetTimeDigitized
+	0x9201: true, // ShutterSpeedValue
+	0x9202: true, // ApertureValue
+	0x9204: true, // ExposureBiasValue
+	0x9205: true, // MaxApertureValue
+	0x9207: true, // MeteringMode
+	0x9209: true, // Flash
+	0x920a: true, // FocalLength
+	0x9290: true, // SubSecTime
+	0x9291: true, // SubSecTimeOriginal
+	0x9292: true, // SubSecTimeDigitized
+	0xa001: true, // ColorSpace
+	0xa403: true, // WhiteBalance
+	0xa405: true, // FocalLengthIn35mmFilm
+	0xa433: true, // LensMake
+	0xa434: true, // LensModel
+}
+
+// exifTag is an entry of a TIFF directory. `value` holds the raw value bytes, in the byte order of the TIFF structure.
+type exifTag struct {
+	id, typ uint16
+	count   uint32
+	value   []byte
+}
+
+// tiffTypeSizes maps the TIFF data types to the size of a single value in bytes. Unknown types have size 0.
+var tiffTypeSizes = [...]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// rewriteExif builds a new EXIF segment for an image of the given size from the EXIF segment `seg`, as returned by `readExif`.
+// Copying the segment as it is would be wrong, or even harmful: The thumbnail in IFD1 still shows the uncropped image, which can leak what was cropped away, and the orientation and dimension tags describe the original pixels. So rewriteExif only keeps the tags listed in `ifd0Tags` and `exifIFDTags`, drops the thumbnail, the GPS position, and the maker notes, resets the orientation to 1 (the pixels are saved upright), and sets the dimensions to `size`.
+func rewriteExif(seg []byte, size image.Point) ([]byte, error) {
+	if len(seg) < 4 || seg[1] != 0xe1 || !bytes.HasPrefix(seg[4:], []byte(exifHeader)) {
+		return nil, errors.New("rewriteExif(): not an EXIF segment")
+	}
+	tiff := seg[4+len(exifHeader):]
+	if len(tiff) < 8 {
+		return nil, errors.New("rewriteExif(): EXIF data is truncated")
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, errors.New("rewriteExif(): invalid TIFF byte order")
+	}
+	if bo.Uint16(tiff[2:]) != 42 {
+		return nil, errors.New("rewriteExif(): invalid TIFF header")
+	}
+
+	ifd0, err := readIFD(tiff, bo, bo.Uint32(tiff[4:]))
+	if err != nil {
+		return nil, err
+	}
+	var exifIFD []exifTag
+	for _, tag := range ifd0 {
+		if tag.id == tagExifIFD && tag.typ == 4 && tag.count == 1 {
+			exifIFD, err = readIFD(tiff, bo, bo.Uint32(tag.value))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	long := func(v uint32) []byte {
+		b := make([]byte, 4)
+		bo.PutUint32(b, v)
+		return b
+	}
+	short := make([]byte, 2)
+	bo.PutUint16(short, 1)
+
+	ifd0 = append(filterTags(ifd0, ifd0Tags), exifTag{tagOrientation, 3, 1, short})
+	exifIFD = append(filterTags(exifIFD, exifIFDTags),
+		exifTag{tagPixelXDimension, 4, 1, long(uint32(size.X))},
+		exifTag{tagPixelYDimension, 4, 1, long(uint32(size.Y))})
+
+	// The new TIFF structure: the header, IFD0 without a link to IFD1, and the EXIF directory.
+	ifd0 = append(ifd0, exifTag{tagExifIFD, 4, 1, nil})
+	ifd0[len(ifd0)-1].value = long(uint32(8 + ifdSize(ifd0)))
+	out := append([]byte(nil), tiff[:2]...)
+	out = append(out, tiff[2:4]...)
+	out = append(out, long(8)...)
+	out = appendIFD(out, bo, ifd0)
+	out = appendIFD(out, bo, exifIFD)
+
+	length := 2 + len(exifHeader) + len(out)
+	if length > 0xffff {
+		return nil, errors.New("rewriteExif(): EXIF data is too large")
+	}
+	res := []byte{0xff, 0xe1, byte(length >> 8), byte(length)}
+	res = append(res, exifHeader...)
+	return append(res, out...), nil
+}
+
+// readIFD reads the TIFF directory at offset `off` of `tiff`. Entries of unknown types are skipped.
+func readIFD(tiff []byte, bo binary.ByteOrder, off uint32) ([]exifTag, error) {
+	if uint64(off)+2 > uint64(len(tiff)) {
+		return nil, errors.New("readIFD(): directory offset out of range")
+	}
+	n := uint64(bo.Uint16(tiff[off:]))
+	if uint64(off)+2+12*n > uint64(len(tiff)) {
+		return nil, errors.New("readIFD(): directory is truncated")
+	}
+
+	var tags []exifTag
+	for i := uint64(0); i < n; i++ {
+		entry := tiff[uint64(off)+2+12*i:]
+		tag := exifTag{id: bo.Uint16(entry), typ: bo.Uint16(entry[2:]), count: bo.Uint32(entry[4:])}
+		if int(tag.typ) >= len(tiffTypeSizes) || tiffTypeSizes[tag.typ] == 0 {
+			continue
+		}
+		size := uint64(tiffTypeSizes[tag.typ]) * uint64(tag.count)
+		// Values of up to four bytes are stored right in the entry, larger ones elsewhere.
+		src := entry[8:]
+		if size > 4 {
+			valOff := uint64(bo.Uint32(entry[8:]))
+			if valOff+size > uint64(len(tiff)) {
+				return nil, errors.Errorf("readIFD(): value of tag 0x%04x out of range", tag.id)
+			}
+			src = tiff[valOff:]
+		}
+		tag.value = append([]byte(nil), src[:size]...)
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// filterTags returns the tags whose IDs are in `keep`.
+func filterTags(tags []exifTag, keep map[uint16]bool) []exifTag {
+	var res []exifTag
+	for _, tag := range tags {
+		if keep[tag.id] {
+			res = append(res, tag)
+		}
+	}
+	return res
+}
+
+// ifdSize returns the number of bytes that `appendIFD` writes for the tags.
+func ifdSize(tags []exifTag) int {
+	size := 2 + 12*len(tags) + 4
+	for _, tag := range tags {
+		if len(tag.value) > 4 {
+			size += len(tag.value) + len(tag.value)%2
+		}
+	}
+	return size
+}
+
+// appendIFD appends a TIFF directory with the tags, followed by the values that do not fit into the entries, to the TIFF structure `tiff`. The directory has no link to a next directory.
+func appendIFD(tiff []byte, bo binary.ByteOrder, tags []exifTag) []byte {
+	// TIFF readers expect the entries in ascending order.
+	sort.Slice(tags, func(i, j int) bool { return tags[i].id < tags[j].id })
+
+	valOff := len(tiff) + 2 + 12*len(tags) + 4
+	var values []byte
+	entry := make([]byte, 12)
+	tiff = append(tiff, 0, 0)
+	bo.PutUint16(tiff[len(tiff)-2:], uint16(len(tags)))
+	for _, tag := range tags {
+		bo.PutUint16(entry, tag.id)
+		bo.PutUint16(entry[2:], tag.typ)
+		bo.PutUint32(entry[4:], tag.count)
+		copy(entry[8:], []byte{0, 0, 0, 0})
+		if len(tag.value) > 4 {
+			bo.PutUint32(entry[8:], uint32(valOff+len(values)))
+			values = append(values, tag.value...)
+			// Values start at word boundaries.
+			if len(values)%2 == 1 {
+				values = append(values, 0)
+			}
+		} else {
+			copy(entry[8:], tag.value)
+		}
+		tiff = append(tiff, entry...)
+	}
+	tiff = append(tiff, 0, 0, 0, 0)
+	return append(tiff, values...)
+}
+
+// iccMarker starts the payload of each APP2 segment that holds a chunk of an ICC profile.
+const iccMarker = "ICC_PROFILE\x00"
+
+// readICCProfile returns the ICC color profile embedded in the JPEG or PNG file at `path`, or nil if there is none.
+// The profile tells color-managed applications how to interpret the pixel values. Pass it to `saveImageAs` via `SaveOptions.ICCProfile` to keep the colors of the processed file faithful.
+func readICCProfile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot read "+path)
+	}
+
+	if bytes.HasPrefix(data, pngSignature) {
+		return readICCFromPNG(data)
+	}
+
+	segs, err := jpegHeaderSegments(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "readICCProfile()")
+	}
+	// A large profile is split into several APP2 segments. Each one carries its sequence number (starting at 1) and the total number of chunks.
+	var chunks [][]byte
+	for _, seg := range segs {
+		p := seg[4:]
+		if seg[1] != 0xe2 || !bytes.HasPrefix(p, []byte(iccMarker)) || len(p) < len(iccMarker)+2 {
+			continue
+		}
+		seq, count := int(p[len(iccMarker)]), int(p[len(iccMarker)+1])
+		if chunks == nil {
+			chunks = make([][]byte, count)
+		}
+		if seq < 1 || seq > len(chunks) {
+			return nil, errors.New("readICCProfile(): invalid ICC chunk number")
+		}
+		chunks[seq-1] = p[len(iccMarker)+2:]
+	}
+	if chunks == nil {
+		return nil, nil
+	}
+	for _, c := range chunks {
+		if c == nil {
+			return nil, errors.New("readICCProfile(): ICC profile is incomplete")
+		}
+	}
+	return bytes.Join(chunks, nil), nil
+}
+
+// iccSegments splits an ICC profile into APP2 segments for embedding into a JPEG file.
+func iccSegments(profile []byte) ([]byte, error) {
+	// A segment can hold 65535 bytes, minus 2 length bytes, the marker string, and the 2 bytes for sequence number and count.
+	const maxChunk = 65535 - 2 - len(iccMarker) - 2
+	count := (len(profile) + maxChunk - 1) / maxChunk
+	if count > 255 {
+		return nil, errors.New("iccSegments(): ICC profile is too large")
+	}
+
+	var out []byte
+	for i := 0; i < count; i++ {
+		chunk := profile[i*maxChunk:]
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		length := 2 + len(iccMarker) + 2 + len(chunk)
+		out = append(out, 0xff, 0xe2, byte(length>>8), byte(length))
+		out = append(out, iccMarker...)
+		out = append(out, byte(i+1), byte(count))
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+// jpegHeaderSegments returns all marker segments of the JPEG data in `r` that precede the image data, each including its marker and length bytes. Fill bytes before a marker are dropped.
+func jpegHeaderSegments(r io.Reader) ([][]byte, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return nil, errors.New("not a JPEG file")
+	}
+
+	// Metadata segments come before the image data, which starts with the SOS marker.
+	var segs [][]byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "truncated JPEG header")
+		}
+		if b != 0xff {
+			return nil, errors.New("invalid JPEG marker")
+		}
+		// Any number of 0xff fill bytes may precede the marker code.
+		marker := b
+		for marker == 0xff {
+			if marker, err = br.ReadByte(); err != nil {
+				return nil, errors.Wrap(err, "truncated JPEG header")
+			}
+		}
+		if marker == 0xda {
+			return segs, nil
+		}
+
+		var lb [2]byte
+		if _, err := io.ReadFull(br, lb[:]); err != nil {
+			return nil, errors.Wrap(err, "truncated JPEG header")
+		}
+		length := int(lb[0])<<8 | int(lb[1])
+		if length < 2 {
+			return nil, errors.New("invalid JPEG segment length")
+		}
+		seg := make([]byte, 2+length)
+		seg[0], seg[1], seg[2], seg[3] = 0xff, marker, lb[0], lb[1]
+		if _, err := io.ReadFull(br, seg[4:]); err != nil {
+			return nil, errors.Wrap(err, "truncated JPEG segment")
+		}
+		segs = append(segs, seg)
+	}
+}
+
+// insertSegment inserts complete JPEG segments right after the SOI marker of the JPEG data.
+func insertSegment(jpegData, seg []byte) ([]byte, error) {
+	if !bytes.HasPrefix(jpegData, []byte{0xff, 0xd8}) {
+		return nil, errors.New("insertSegment(): not JPEG data")
+	}
+	out := make([]byte, 0, len(jpegData)+len(seg))
+	out = append(out, jpegData[:2]...)
+	out = append(out, seg...)
+	return append(out, jpegData[2:]...), nil
+}
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// readICCFromPNG extracts the ICC profile from the iCCP chunk of PNG data, or returns nil if there is none.
+func readICCFromPNG(data []byte) ([]byte, error) {
+	for p := data[len(pngSignature):]; len(p) >= 12; {
+		length := int(binary.BigEndian.Uint32(p))
+		if len(p) < 12+length {
+			return nil, errors.New("readICCFromPNG(): truncated chunk")
+		}
+		typ, body := string(p[4:8]), p[8:8+length]
+		switch typ {
+		case "iCCP":
+			// The chunk holds a profile name, a zero byte, the compression method (always 0 = zlib), and the compressed profile.
+			i := bytes.IndexByte(body, 0)
+			if i < 0 || i+2 > len(body) {
+				return nil, errors.New("readICCFromPNG(): invalid iCCP chunk")
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(body[i+2:]))
+			if err != nil {
+				return nil, errors.Wrap(err, "readICCFromPNG(): cannot decompress profile")
+			}
+			defer zr.Close()
+			profile, err := ioutil.ReadAll(zr)
+			return profile, errors.Wrap(err, "readICCFromPNG(): cannot decompress profile")
+		case "IDAT", "IEND":
+			// The iCCP chunk must come before the image data.
+			return nil, nil
+		}
+		p = p[12+length:]
+	}
+	return nil, nil
+}
+
+// embedICCInPNG inserts an iCCP chunk with the given ICC profile into PNG data, right after the IHDR chunk. The Go PNG encoder always writes IHDR first.
+func embedICCInPNG(pngData, profile []byte) ([]byte, error) {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4 // signature, then the IHDR chunk: length, type, data, CRC
+	if !bytes.HasPrefix(pngData, pngSignature) || len(pngData) < ihdrEnd || string(pngData[12:16]) != "IHDR" {
+		return nil, errors.New("embedICCInPNG(): not PNG data")
+	}
+
+	var body bytes.Buffer
+	body.WriteString("ICC Profile\x00\x00")
+	zw := zlib.NewWriter(&body)
+	if _, err := zw.Write(profile); err != nil {
+		return nil, errors.Wrap(err, "embedICCInPNG(): cannot compress profile")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "embedICCInPNG(): cannot compress profile")
+	}
+
+	chunk := make([]byte, 8, 12+body.Len())
+	binary.BigEndian.PutUint32(chunk, uint32(body.Len()))
+	copy(chunk[4:], "iCCP")
+	chunk = append(chunk, body.Bytes()...)
+	// The CRC covers the chunk type and data.
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+
+	out := make([]byte, 0, len(pngData)+len(chunk))
+	out = append(out, pngData[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, pngData[ihdrEnd:]...), nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+// testExif returns an EXIF segment in big-endian byte order with a camera model, an orientation of 6 (rotate 90° clockwise), GPS and thumbnail pointers, and an EXIF directory with the capture date, the original dimensions, and a maker note.
+func testExif() []byte {
+	bo := binary.BigEndian
+	u32 := func(v uint32) []byte { b := make([]byte, 4); bo.PutUint32(b, v); return b }
+	u16 := func(v uint16) []byte { b := make([]byte, 2); bo.PutUint16(b, v); return b }
+
+	ifd0 := []exifTag{
+		{0x0110, 2, 10, []byte("Canon EOS\x00")},
+		{tagOrientation, 3, 1, u16(6)},
+		{0x8825, 4, 1, u32(0)}, // GPS directory, which is dropped anyway
+		{tagExifIFD, 4, 1, nil},
+	}
+	ifd0[3].value = u32(uint32(8 + ifdSize(ifd0)))
+	exif := []exifTag{
+		{0x9003, 2, 20, []byte("2016:12:22 10:11:12\x00")},
+		{tagPixelXDimension, 4, 1, u32(3456)},
+		{tagPixelYDimension, 4, 1, u32(2304)},
+		{0x927c, 7, 8, []byte("MAKERNTE")},
+	}
+	ifd1 := []exifTag{
+		{0x0201, 4, 1, u32(0)}, // JPEGInterchangeFormat
+		{0x0202, 4, 1, u32(0)}, // JPEGInterchangeFormatLength
+	}
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = appendIFD(tiff, bo, ifd0)
+	tiff = appendIFD(tiff, bo, exif)
+	// Link IFD0 to IFD1, like cameras do for the thumbnail.
+	bo.PutUint32(tiff[8+2+12*len(ifd0):], uint32(len(tiff)))
+	tiff = appendIFD(tiff, bo, ifd1)
+
+	length := 2 + len(exifHeader) + len(tiff)
+	seg := []byte{0xff, 0xe1, byte(length >> 8), byte(length)}
+	seg = append(seg, exifHeader...)
+	return append(seg, tiff...)
+}
+
+// exifTags returns the tags of IFD0 and the EXIF directory of an EXIF segment, and the offset of IFD1.
+func exifTags(t *testing.T, seg []byte) (ifd0, exif map[uint16]exifTag, next uint32) {
+	t.Helper()
+	tiff := seg[4+len(exifHeader):]
+	bo := binary.ByteOrder(binary.BigEndian)
+	if string(tiff[:2]) == "II" {
+		bo = binary.LittleEndian
+	}
+	read := func(off uint32) map[uint16]exifTag {
+		tags, err := readIFD(tiff, bo, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := map[uint16]exifTag{}
+		for _, tag := range tags {
+			m[tag.id] = tag
+		}
+		return m
+	}
+	off := bo.Uint32(tiff[4:])
+	ifd0 = read(off)
+	next = bo.Uint32(tiff[off+2+12*uint32(len(ifd0)):])
+	if ptr, ok := ifd0[tagExifIFD]; ok {
+		exif = read(bo.Uint32(ptr.value))
+	}
+	return ifd0, exif, next
+}
+
+func TestExifSurvivesCropAndSave(t *testing.T) {
+	img, err := cropAround(colorGradient(120, 80), 30, 30, 50, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := saveImageAs(img, dir, "out.jpg", SaveOptions{Exif: testExif()}); err != nil {
+		t.Fatal(err)
+	}
+	seg, err := readExif(filepath.Join(dir, "out.jpg"))
+	if err != nil || seg == nil {
+		t.Fatalf("no EXIF data in the saved file (%v)", err)
+	}
+
+	ifd0, exif, next := exifTags(t, seg)
+	if got := string(exif[0x9003].value); got != "2016:12:22 10:11:12\x00" {
+		t.Errorf("DateTimeOriginal: got %q", got)
+	}
+	if got := string(ifd0[0x0110].value); got != "Canon EOS\x00" {
+		t.Errorf("Model: got %q", got)
+	}
+	if got := binary.BigEndian.Uint16(ifd0[tagOrientation].value); got != 1 {
+		t.Errorf("Orientation: got %d, want 1", got)
+	}
+	w := binary.BigEndian.Uint32(exif[tagPixelXDimension].value)
+	h := binary.BigEndian.Uint32(exif[tagPixelYDimension].value)
+	if w != 50 || h != 40 {
+		t.Errorf("dimensions: got %dx%d, want 50x40", w, h)
+	}
+	if next != 0 {
+		t.Error("the thumbnail directory IFD1 is still linked")
+	}
+	if _, ok := ifd0[0x8825]; ok {
+		t.Error("the GPS pointer was copied")
+	}
+	if _, ok := exif[0x927c]; ok {
+		t.Error("the maker note was copied")
+	}
+}
+
+func TestRewriteExifRejectsGarbage(t *testing.T) {
+	for _, seg := range [][]byte{
+		[]byte("\xff\xe1\x00\x08Exif\x00\x00"),
+		[]byte("\xff\xe1\x00\x10Exif\x00\x00XX\x00\x2a\x00\x00\x00\x08"),
+		[]byte("\xff\xe1\x00\x10Exif\x00\x00MM\x00\x2a\x00\x00\xff\xff"),
+	} {
+		if _, err := rewriteExif(seg, image.Pt(1, 1)); err == nil {
+			t.Errorf("rewriteExif(%q): want an error", seg)
+		}
+	}
+}
+
+func TestICCProfileSurvivesSave(t *testing.T) {
+	// The large profile needs more than one APP2 segment in a JPEG file.
+	small := append([]byte("fake ICC profile"), make([]byte, 100)...)
+	large := bytes.Repeat([]byte("0123456789abcdef"), 5000)
+
+	dir := t.TempDir()
+	for _, name := range []string{"out.jpg", "out.png"} {
+		for _, profile := range [][]byte{small, large} {
+			if err := saveImageAs(colorGradient(40, 30), dir, name, SaveOptions{ICCProfile: profile}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readICCProfile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, profile) {
+				t.Errorf("%s: got a profile of %d bytes, want the %d bytes of the source", name, len(got), len(profile))
+			}
+		}
+
+		if err := saveImageAs(colorGradient(40, 30), dir, name, SaveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := readICCProfile(filepath.Join(dir, name)); got != nil || err != nil {
+			t.Errorf("%s without a profile: got %d bytes (%v), want none", name, len(got), err)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !heic
+// +build !heic
+
+package main
+
+// heicSupported reports whether this build can decode HEIC files. The HEIC decoder needs cgo, so it is only built with `-tags heic` (see heic.go).
+const heicSupported = false
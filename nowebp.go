@@ -0,0 +1,16 @@
+//go:build !webp
+// +build !webp
+
+package main
+
+import (
+	"image"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// encodeWebP is a placeholder for builds without WebP support. The WebP encoder needs cgo, so it is only built with `-tags webp`.
+func encodeWebP(w io.Writer, img image.Image, quality int) error {
+	return errors.New("encodeWebP(): WebP support is not built in; rebuild with -tags webp")
+}
@@ -0,0 +1,28 @@
+//go:build !webp
+// +build !webp
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWebPNotBuiltIn(t *testing.T) {
+	err := encodeImage(ioutil.Discard, colorGradient(8, 8), "webp", SaveOptions{})
+	if err == nil || !strings.Contains(err.Error(), "-tags webp") {
+		t.Errorf("got error %v, want a hint to rebuild with -tags webp", err)
+	}
+
+	// saveImageAs does not leave an empty file behind.
+	dir := t.TempDir()
+	if err := saveImageAs(colorGradient(8, 8), dir, "out.webp", SaveOptions{}); err == nil {
+		t.Error("saveImageAs: want an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.webp")); !os.IsNotExist(err) {
+		t.Errorf("out.webp: got %v, want no such file", err)
+	}
+}
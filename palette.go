@@ -0,0 +1,253 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// quantize reduces the image to at most `numColors` colors, using the median-cut algorithm. It returns the paletted image together with its palette.
+// A paletted image is what the GIF encoder needs anyway, and the reduced palette also makes for an interesting stylization. `numColors` must be between 2 and 256.
+func quantize(img image.Image, numColors int) (image.Image, color.Palette, error) {
+	if numColors < 2 || numColors > 256 {
+		return nil, nil, errors.New("quantize(): numColors must be between 2 and 256")
+	}
+
+	pal := medianCut(img, numColors)
+
+	// Drawing into a paletted image maps every pixel to the nearest palette color.
+	b := img.Bounds()
+	dst := image.NewPaletted(b, pal)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	return dst, pal, nil
+}
+
+// saveIndexedPNG reduces the image to at most `numColors` colors with `quantize` and saves it to `pname/fname` as an indexed-color PNG, which stores one palette index per pixel instead of a full RGBA color. For graphics with few colors, like logos, screenshots, or posterized images, this yields much smaller files than a truecolor PNG.
+// `fname` must end in ".png". (Any `*image.Paletted` is saved as indexed-color PNG anyway; `image/png` takes care of that.)
+func saveIndexedPNG(img image.Image, numColors int, pname, fname string) error {
+	if formatFromName(fname) != "png" {
+		return errors.New("saveIndexedPNG(): file name must end in .png")
+	}
+	q, _, err := quantize(img, numColors)
+	if err != nil {
+		return err
+	}
+	return saveImageAs(q, pname, fname, SaveOptions{})
+}
+
+// medianCut computes a palette of at most `numColors` colors for the image.
+func medianCut(img image.Image, numColors int) color.Palette {
+	b := img.Bounds()
+	pixels := make(colorBox, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			pixels = append(pixels, color.RGBAModel.Convert(img.At(x, y)).(color.RGBA))
+		}
+	}
+
+	// Median cut: Start with one box containing all pixels. Then repeatedly take the box with the widest spread in any channel and split it at the median of that channel.
+	boxes := []colorBox{pixels}
+	for len(boxes) < numColors {
+		idx, ch, spread := -1, 0, uint8(0)
+		for i, box := range boxes {
+			c, s := box.widestChannel()
+			if s > spread {
+				idx, ch, spread = i, c, s
+			}
+		}
+		// Every box contains only a single color; no need to split any further.
+		if idx < 0 {
+			break
+		}
+
+		box := boxes[idx]
+		sort.Slice(box, func(i, j int) bool {
+			return channelValue(box[i], ch) < channelValue(box[j], ch)
+		})
+		mid := len(box) / 2
+		boxes[idx] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	// Each box contributes its average color to the palette.
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		pal[i] = box.average()
+	}
+	return pal
+}
+
+// dominantColors returns the `n` most representative colors of the image, most frequent first. This comes in handy for deriving a UI theme or accent colors from a photo.
+// The colors are found by k-means clustering. To keep this fast for large images, only a grid of about 10,000 sample pixels is taken into account. The result can have fewer than `n` colors if the image does not have enough distinct colors.
+func dominantColors(img image.Image, n int) ([]color.RGBA, error) {
+	if n < 1 {
+		return nil, errors.New("dominantColors(): n must be positive")
+	}
+	samples := samplePixels(img, 10000)
+	if len(samples) == 0 {
+		return nil, errors.New("dominantColors(): image is empty")
+	}
+
+	// Pick the initial centers deterministically: Start with the first sample, then keep adding the sample that is farthest away from all centers so far.
+	centers := [][3]float64{toVec(samples[0])}
+	for len(centers) < n {
+		far, farDist := -1, 0.0
+		for i, s := range samples {
+			_, d := nearestCenter(toVec(s), centers)
+			if d > farDist {
+				far, farDist = i, d
+			}
+		}
+		// All samples coincide with a center already.
+		if far < 0 {
+			break
+		}
+		centers = append(centers, toVec(samples[far]))
+	}
+
+	// Lloyd's algorithm: Assign each sample to its nearest center, then move each center to the mean of its samples. Repeat until nothing changes.
+	counts := make([]int, len(centers))
+	for iter := 0; iter < 20; iter++ {
+		sums := make([][3]float64, len(centers))
+		for i := range counts {
+			counts[i] = 0
+		}
+		for _, s := range samples {
+			v := toVec(s)
+			c, _ := nearestCenter(v, centers)
+			counts[c]++
+			for j := 0; j < 3; j++ {
+				sums[c][j] += v[j]
+			}
+		}
+		moved := false
+		for i := range centers {
+			if counts[i] == 0 {
+				continue
+			}
+			for j := 0; j < 3; j++ {
+				m := sums[i][j] / float64(counts[i])
+				if m != centers[i][j] {
+					centers[i][j] = m
+					moved = true
+				}
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+
+	// Sort the clusters by size, largest first.
+	order := make([]int, len(centers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+
+	colors := make([]color.RGBA, 0, len(centers))
+	for _, i := range order {
+		if counts[i] == 0 {
+			continue
+		}
+		c := centers[i]
+		colors = append(colors, color.RGBA{uint8(math.Round(c[0])), uint8(math.Round(c[1])), uint8(math.Round(c[2])), 255})
+	}
+	return colors, nil
+}
+
+// samplePixels returns about `limit` pixels of the image, taken from an evenly spaced grid.
+func samplePixels(img image.Image, limit int) []color.RGBA {
+	b := img.Bounds()
+	step := 1
+	if n := b.Dx() * b.Dy(); n > limit {
+		step = int(math.Ceil(math.Sqrt(float64(n) / float64(limit))))
+	}
+
+	var samples []color.RGBA
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			samples = append(samples, color.RGBAModel.Convert(img.At(x, y)).(color.RGBA))
+		}
+	}
+	return samples
+}
+
+// toVec turns a color into a point in RGB space.
+func toVec(c color.RGBA) [3]float64 {
+	return [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+}
+
+// nearestCenter returns the index of the center closest to `v`, and the squared distance to it.
+func nearestCenter(v [3]float64, centers [][3]float64) (int, float64) {
+	best, bestDist := 0, math.Inf(1)
+	for i, c := range centers {
+		d := (v[0]-c[0])*(v[0]-c[0]) + (v[1]-c[1])*(v[1]-c[1]) + (v[2]-c[2])*(v[2]-c[2])
+		if d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best, bestDist
+}
+
+// colorBox is a set of pixels for the median-cut algorithm.
+type colorBox []color.RGBA
+
+// widestChannel returns the channel (0=R, 1=G, 2=B) with the largest value range within the box, and that range.
+func (box colorBox) widestChannel() (ch int, spread uint8) {
+	if len(box) == 0 {
+		return 0, 0
+	}
+	lo := [3]uint8{255, 255, 255}
+	hi := [3]uint8{}
+	for _, c := range box {
+		for i := 0; i < 3; i++ {
+			v := channelValue(c, i)
+			if v < lo[i] {
+				lo[i] = v
+			}
+			if v > hi[i] {
+				hi[i] = v
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if hi[i]-lo[i] > spread {
+			ch, spread = i, hi[i]-lo[i]
+		}
+	}
+	return ch, spread
+}
+
+// average returns the mean color of the box.
+func (box colorBox) average() color.RGBA {
+	if len(box) == 0 {
+		return color.RGBA{A: 255}
+	}
+	var r, g, b, a int
+	for _, c := range box {
+		r += int(c.R)
+		g += int(c.G)
+		b += int(c.B)
+		a += int(c.A)
+	}
+	n := len(box)
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)}
+}
+
+// channelValue returns the R (0), G (1), or B (2) component of `c`.
+func channelValue(c color.RGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	for _, n := range []int{2, 8, 16} {
+		out, pal, err := quantize(colorGradient(64, 64), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pal) > n {
+			t.Errorf("quantize(%d): palette has %d colors", n, len(pal))
+		}
+		seen := map[color.Color]bool{}
+		b := out.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				seen[out.At(x, y)] = true
+			}
+		}
+		if len(seen) > n {
+			t.Errorf("quantize(%d): output has %d distinct colors", n, len(seen))
+		}
+	}
+}
+
+func TestDominantColors(t *testing.T) {
+	// 70% blue on the left, 30% red on the right.
+	img := solidImage(100, 10, color.RGBA{0, 0, 255, 255})
+	for y := 0; y < 10; y++ {
+		for x := 70; x < 100; x++ {
+			img.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+
+	colors, err := dominantColors(img, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []color.RGBA{{0, 0, 255, 255}, {255, 0, 0, 255}}
+	if len(colors) != 2 || colors[0] != want[0] || colors[1] != want[1] {
+		t.Errorf("got %v, want %v", colors, want)
+	}
+
+	if _, err := dominantColors(image.NewRGBA(image.Rect(0, 0, 0, 0)), 2); err == nil {
+		t.Error("empty image: want an error")
+	}
+}
+
+func TestDominantColorsInput(t *testing.T) {
+	img := solidImage(10, 10, color.RGBA{10, 20, 30, 255})
+	for _, n := range []int{0, -1} {
+		if _, err := dominantColors(img, n); err == nil {
+			t.Errorf("n=%d: want an error", n)
+		}
+	}
+	// A single-color image cannot yield more than one color.
+	colors, err := dominantColors(img, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(colors) != 1 || colors[0] != (color.RGBA{10, 20, 30, 255}) {
+		t.Errorf("single color, n=3: got %v, want just that color", colors)
+	}
+}
+
+func TestSaveIndexedPNG(t *testing.T) {
+	// Eight colors in a pseudo-random pattern, so that PNG's filters cannot compress the truecolor file down to the size of the indexed one.
+	colors := []color.RGBA{
+		{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 0, 255},
+		{0, 255, 255, 255}, {255, 0, 255, 255}, {0, 0, 0, 255}, {255, 255, 255, 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			img.SetRGBA(x, y, colors[rng.Intn(len(colors))])
+		}
+	}
+
+	dir := t.TempDir()
+	if err := saveIndexedPNG(img, 8, dir, "indexed.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveImageAs(img, dir, "truecolor.png", SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	indexed, err := os.Stat(filepath.Join(dir, "indexed.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truecolor, err := os.Stat(filepath.Join(dir, "truecolor.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed.Size() >= truecolor.Size() {
+		t.Errorf("indexed PNG has %d bytes, want fewer than the truecolor PNG's %d", indexed.Size(), truecolor.Size())
+	}
+
+	out, err := openImage(filepath.Join(dir, "indexed.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pal, ok := out.(*image.Paletted)
+	if !ok {
+		t.Fatalf("decoded indexed PNG is %T, want *image.Paletted", out)
+	}
+	if len(pal.Palette) > 8 {
+		t.Errorf("palette has %d colors, want at most 8", len(pal.Palette))
+	}
+
+	if err := saveIndexedPNG(img, 8, dir, "indexed.gif"); err == nil {
+		t.Error("non-PNG name: want an error")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"image"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthonynsimon/bild/adjust"
+	"github.com/anthonynsimon/bild/effect"
+	"github.com/pkg/errors"
+)
+
+// pipelineStep is a named image operation, such as `saturate` or `sharpen`.
+type pipelineStep struct {
+	name string
+	op   func(image.Image) image.Image
+}
+
+// runPipeline applies the steps to the image in the given order and returns the final result.
+// Timing is opt-in: If `timings` is not nil, runPipeline adds the duration of each step to `timings[step.name]`. This reveals where the time goes - `primitivePicture`, for example, takes far longer than all the `bild` steps together.
+func runPipeline(img image.Image, steps []pipelineStep, timings map[string]time.Duration) image.Image {
+	for _, s := range steps {
+		if timings == nil {
+			img = s.op(img)
+			continue
+		}
+		start := time.Now()
+		img = s.op(img)
+		timings[s.name] += time.Since(start)
+	}
+	return img
+}
+
+// timed wraps an operation so that each call reports its duration to `logger`. Unlike the `timings` map of `runPipeline`, it works with any code that calls operations of this signature, for example the `op` of a `pipelineStep`:
+//
+//	steps = append(steps, pipelineStep{"sharpen", timed("sharpen", sharpen)})
+func timed(name string, op func(image.Image) image.Image) func(image.Image) image.Image {
+	return func(img image.Image) image.Image {
+		start := time.Now()
+		res := op(img)
+		logger.Printf("%s took %v", name, time.Since(start))
+		return res
+	}
+}
+
+// chainOp describes an operation for `applyChain`: its default parameters, which also define how many parameters it takes, and a function that builds the step from the parameters.
+type chainOp struct {
+	defaults []float64
+	build    func(p []float64) (func(image.Image) image.Image, error)
+}
+
+// chainOps are the operations that `applyChain` knows, with the same defaults as the article where there is one.
+var chainOps = map[string]chainOp{
+	"saturate": {[]float64{0.5}, func(p []float64) (func(image.Image) image.Image, error) {
+		return func(img image.Image) image.Image { return adjust.Saturation(img, p[0]) }, nil
+	}},
+	"sharpen": {[]float64{0.6, 1.2}, func(p []float64) (func(image.Image) image.Image, error) {
+		if p[0] <= 0 {
+			return nil, errors.New("radius must be positive")
+		}
+		return func(img image.Image) image.Image { return effect.UnsharpMask(img, p[0], p[1]) }, nil
+	}},
+	"blur": {[]float64{2}, func(p []float64) (func(image.Image) image.Image, error) {
+		if p[0] <= 0 {
+			return nil, errors.New("radius must be positive")
+		}
+		return func(img image.Image) image.Image { return gaussianBlur(img, p[0]) }, nil
+	}},
+	"multiply": {nil, func(p []float64) (func(image.Image) image.Image, error) {
+		return multiply, nil
+	}},
+	"gamma": {[]float64{1}, func(p []float64) (func(image.Image) image.Image, error) {
+		if p[0] <= 0 {
+			return nil, errors.New("gamma must be positive")
+		}
+		return func(img image.Image) image.Image { return gamma(img, p[0]) }, nil
+	}},
+	"exposure": {[]float64{0}, func(p []float64) (func(image.Image) image.Image, error) {
+		return func(img image.Image) image.Image { return exposure(img, p[0]) }, nil
+	}},
+	"brightness": {[]float64{0}, func(p []float64) (func(image.Image) image.Image, error) {
+		return func(img image.Image) image.Image { return brightness(img, p[0]) }, nil
+	}},
+	"contrast": {[]float64{0}, func(p []float64) (func(image.Image) image.Image, error) {
+		return func(img image.Image) image.Image { return contrast(img, p[0]) }, nil
+	}},
+	"grayscale": {nil, func(p []float64) (func(image.Image) image.Image, error) {
+		return func(img image.Image) image.Image { return effect.Grayscale(img) }, nil
+	}},
+	"invert": {nil, func(p []float64) (func(image.Image) image.Image, error) {
+		return func(img image.Image) image.Image { return effect.Invert(img) }, nil
+	}},
+}
+
+// applyChain applies a chain of operations, written as a compact string, to the image. This makes effects scriptable, for example from a command-line flag or a config file.
+// The operations are separated by "|" and run from left to right. Each operation may be followed by a colon and comma-separated parameters; omitted parameters keep their defaults. For example, "saturate:0.5|sharpen:0.6,1.2|blur:2" saturates, sharpens, and blurs the image. See `chainOps` for the available operations.
+func applyChain(img image.Image, spec string) (image.Image, error) {
+	steps, err := parseChain(spec)
+	if err != nil {
+		return nil, err
+	}
+	return runPipeline(img, steps, nil), nil
+}
+
+// parseChain turns a chain spec (see `applyChain`) into pipeline steps. All operations and parameters are checked before any of them runs.
+func parseChain(spec string) ([]pipelineStep, error) {
+	var steps []pipelineStep
+	for i, part := range strings.Split(spec, "|") {
+		name, args := strings.TrimSpace(part), ""
+		if colon := strings.IndexByte(name, ':'); colon >= 0 {
+			name, args = strings.TrimSpace(name[:colon]), name[colon+1:]
+		}
+		op, ok := chainOps[name]
+		if !ok {
+			return nil, errors.Errorf("applyChain(): step %d: unknown operation %q", i+1, name)
+		}
+
+		params := append([]float64(nil), op.defaults...)
+		if strings.TrimSpace(args) != "" {
+			fields := strings.Split(args, ",")
+			if len(fields) > len(params) {
+				return nil, errors.Errorf("applyChain(): step %d: %s takes at most %d parameter(s), got %d", i+1, name, len(params), len(fields))
+			}
+			for j, f := range fields {
+				v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+				if err != nil {
+					return nil, errors.Errorf("applyChain(): step %d: %s: invalid parameter %q", i+1, name, f)
+				}
+				params[j] = v
+			}
+		}
+
+		fn, err := op.build(params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "applyChain(): step %d: %s", i+1, name)
+		}
+		steps = append(steps, pipelineStep{name: name, op: fn})
+	}
+	return steps, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/anthonynsimon/bild/effect"
+)
+
+// sleepy returns an operation that passes the image through after waiting for `d`.
+func sleepy(d time.Duration) func(image.Image) image.Image {
+	return func(img image.Image) image.Image {
+		time.Sleep(d)
+		return img
+	}
+}
+
+func TestRunPipelineTimings(t *testing.T) {
+	steps := []pipelineStep{
+		{"first", sleepy(20 * time.Millisecond)},
+		{"second", sleepy(40 * time.Millisecond)},
+	}
+	timings := map[string]time.Duration{}
+
+	start := time.Now()
+	runPipeline(grayGradient(8, 8), steps, timings)
+	wall := time.Since(start)
+
+	var sum time.Duration
+	for _, s := range steps {
+		d, ok := timings[s.name]
+		if !ok {
+			t.Fatalf("no timing for %s", s.name)
+		}
+		sum += d
+	}
+	if timings["first"] < 20*time.Millisecond || timings["second"] < 40*time.Millisecond {
+		t.Errorf("timings %v are shorter than the steps", timings)
+	}
+	if sum > wall || sum < wall*9/10 {
+		t.Errorf("timings add up to %v, want roughly the wall time %v", sum, wall)
+	}
+}
+
+func TestTimed(t *testing.T) {
+	log := captureLog(t)
+	img := grayGradient(8, 8)
+
+	if out := timed("slow", sleepy(30*time.Millisecond))(img); out != image.Image(img) {
+		t.Error("timed did not return the result of the operation")
+	}
+	if len(log.messages) != 1 {
+		t.Fatalf("got messages %q, want one", log.messages)
+	}
+	var name, took, dur string
+	if _, err := fmt.Sscan(log.messages[0], &name, &took, &dur); err != nil || name != "slow" || took != "took" {
+		t.Fatalf("got message %q, want \"slow took <duration>\"", log.messages[0])
+	}
+	d, err := time.ParseDuration(dur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d < 30*time.Millisecond || d > time.Second {
+		t.Errorf("logged %v for a 30ms operation", d)
+	}
+}
+
+func TestApplyChain(t *testing.T) {
+	img := colorGradient(32, 32)
+
+	got, err := applyChain(img, "gamma:2.2 | invert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := effect.Invert(gamma(img, 2.2)); !samePixels(got, want) {
+		t.Error(`"gamma:2.2 | invert" differs from calling gamma and invert directly`)
+	}
+
+	// Omitted parameters keep their defaults.
+	got, err = applyChain(img, "sharpen:0.8|blur")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := gaussianBlur(effect.UnsharpMask(img, 0.8, 1.2), 2); !samePixels(got, want) {
+		t.Error(`"sharpen:0.8|blur" differs from calling sharpen and blur with the defaults`)
+	}
+
+	for _, spec := range []string{"gamma|emboss", "gamma:1,2", "gamma:x", "blur:0", ""} {
+		if _, err := applyChain(img, spec); err == nil {
+			t.Errorf("%q: want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/fogleman/primitive/primitive"
+	"github.com/pkg/errors"
+)
+
+// primitiveUntil works like `primitivePicture`, but instead of adding a fixed number of shapes, it keeps adding shapes until the picture is close enough to the original, or until `maxShapes` shapes are drawn. It returns the picture and the number of shapes used.
+// `filter` and `background` work as in `primitivePicture`: the filter resizes the image to 256x256 first, and a nil background means the average color of the image.
+// `targetError` is compared against the model's score, the root-mean-square difference between the picture and the (resized) original, on a scale from 0 (identical) to 1. Simple images reach the target after a few shapes, while busy ones may need all of them.
+func primitiveUntil(img image.Image, filter transform.ResampleFilter, background color.Color, targetError float64, maxShapes int) (image.Image, int, error) {
+	if targetError < 0 || targetError > 1 {
+		return nil, 0, errors.New("primitiveUntil(): targetError must be between 0 and 1")
+	}
+	if maxShapes <= 0 {
+		return nil, 0, errors.New("primitiveUntil(): maxShapes must be positive")
+	}
+
+	model := newPrimitiveModel(img, filter, background)
+
+	// The background alone may be good enough already, for example for a single-colored image.
+	shapes := 0
+	for shapes < maxShapes && model.Score > targetError {
+		model.Step(primitive.ShapeType(5), 128, 0)
+		shapes++
+	}
+	return model.Context.Image(), shapes, nil
+}
+
+// newPrimitiveModel sets up the `primitive` model that `primitivePicture` and `primitiveUntil` add their shapes to.
+func newPrimitiveModel(img image.Image, filter transform.ResampleFilter, background color.Color) *primitive.Model {
+	// Resize the image to 256x256 to save processing time.
+	// `transform` is a `bild` package. `filter` is the interpolation filter for resizing; `transform.Linear` is a good default here. (See resize.go for other choices.)
+	img = transform.Resize(img, 256, 256, filter)
+
+	// Set the background color. Unless the caller picked one, the average color of the image is a safe choice. A contrasting color, like black or white, gives a different look.
+	if background == nil {
+		background = primitive.AverageImageColor(img)
+	}
+	bg := primitive.MakeColor(background)
+
+	// NewModel(image, background color, output size, # of workers)
+	return primitive.NewModel(img, bg, 1024, runtime.NumCPU())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+func TestPrimitiveUntil(t *testing.T) {
+	// The average color alone reproduces a solid image, so no shapes are needed.
+	solid := solidImage(64, 64, color.RGBA{30, 120, 200, 255})
+	out, shapes, err := primitiveUntil(solid, transform.Linear, nil, 0.05, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shapes >= 50 {
+		t.Errorf("solid image: used %d shapes, want fewer than 50", shapes)
+	}
+	assertColor(t, "solid image", out, 10, 10, color.NRGBA{30, 120, 200, 255}, 2)
+
+	// A black background is far off, so it takes shapes to get close.
+	_, shapes, err = primitiveUntil(solid, transform.Linear, color.Black, 0.05, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shapes == 0 {
+		t.Error("black background: used no shapes, want some")
+	}
+
+	if _, _, err := primitiveUntil(solid, transform.Linear, nil, 1.5, 50); err == nil {
+		t.Error("targetError 1.5: want an error")
+	}
+	if _, _, err := primitiveUntil(solid, transform.Linear, nil, 0.05, 0); err == nil {
+		t.Error("maxShapes 0: want an error")
+	}
+}
+
+func TestPrimitivePictureBackground(t *testing.T) {
+	log := captureLog(t)
+
+	// A single shape does not cover the whole picture, so some of the background still shows, and the corners trend towards it. `primitivePicture` adds 100 shapes to the same model, which takes too long for a test.
+	img := solidImage(64, 64, color.RGBA{128, 128, 128, 255})
+	draw.Draw(img, image.Rect(16, 16, 48, 48), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	corners := func(bg color.Color) float64 {
+		model := newPrimitiveModel(img, transform.Linear, bg)
+		addShapes(model, 1)
+		out := model.Context.Image()
+		b := out.Bounds()
+		sum := 0.0
+		for _, p := range []image.Point{{b.Min.X, b.Min.Y}, {b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, {b.Max.X - 1, b.Max.Y - 1}} {
+			sum += float64(color.GrayModel.Convert(out.At(p.X, p.Y)).(color.Gray).Y)
+		}
+		return sum / 4
+	}
+	if dark, light := corners(color.Black), corners(color.White); dark >= light {
+		t.Errorf("corners on black: %.0f, on white: %.0f, want darker corners on black", dark, light)
+	}
+	// One line when starting and one when done, not one per shape.
+	if len(log.messages) != 4 {
+		t.Errorf("two runs logged %d messages, want 4: %q", len(log.messages), log.messages)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/anthonynsimon/bild/effect"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/appliedgo/imageprocessing/internal/jpegdec"
+	"github.com/pkg/errors"
+)
+
+/*
+`transform.Resize` takes an interpolation filter that trades quality for speed. The most useful ones are:
+
+* `transform.NearestNeighbor`: the fastest filter. Copies pixels without blending them, which preserves the hard edges of pixel art but makes photos look jagged.
+* `transform.Linear`: fast, with smooth results. Slightly soft when downscaling.
+* `transform.CatmullRom`: slower, but gives noticeably sharper downscales.
+* `transform.Lanczos`: the slowest, and the sharpest. May produce halos along strong edges.
+*/
+
+// resizeFit scales the image so that it fits into `maxW` x `maxH`, keeping the aspect ratio, using the given filter (see above). Unless `upscale` is set, images that already fit are returned unchanged.
+// Upscaling with `transform.NearestNeighbor` turns each pixel into a flat block, which gives crisp pixel-art enlargements.
+func resizeFit(img image.Image, maxW, maxH int, filter transform.ResampleFilter, upscale bool) image.Image {
+	b := img.Bounds()
+	w, h := fitSize(b.Dx(), b.Dy(), maxW, maxH, upscale)
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	return transform.Resize(img, w, h, filter)
+}
+
+// fitSize returns the largest size with the aspect ratio of `w` x `h` that fits into `maxW` x `maxH`. Unless `upscale` is set, the size is no larger than `w` x `h`. Neither dimension drops below 1.
+func fitSize(w, h, maxW, maxH int, upscale bool) (int, int) {
+	ratio := math.Min(float64(maxW)/float64(w), float64(maxH)/float64(h))
+	if !upscale {
+		ratio = math.Min(1, ratio)
+	}
+	nw := int(math.Max(1, math.Round(float64(w)*ratio)))
+	nh := int(math.Max(1, math.Round(float64(h)*ratio)))
+	return nw, nh
+}
+
+// scale resizes the image by `factor` in both dimensions, for example 0.5 for half the size or 2 for double. Unlike `resizeFit`, it also upscales. The new dimensions are rounded and never drop below 1.
+func scale(img image.Image, factor float64) (image.Image, error) {
+	if factor <= 0 {
+		return nil, errors.New("scale(): factor must be positive")
+	}
+	b := img.Bounds()
+	w := int(math.Max(1, math.Round(float64(b.Dx())*factor)))
+	h := int(math.Max(1, math.Round(float64(b.Dy())*factor)))
+	return transform.Resize(img, w, h, transform.Linear), nil
+}
+
+// coverBackground fills a `w` x `h` canvas with the image in the popular "blurred backdrop" style for cards and banners: The whole image is scaled to fit into the canvas and centered, and the bars that remain on two sides show a blurred copy of the image, scaled up to cover the whole canvas.
+func coverBackground(img image.Image, w, h int) (image.Image, error) {
+	b := img.Bounds()
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("coverBackground(): canvas size must be positive")
+	}
+	if b.Empty() {
+		return nil, errors.New("coverBackground(): image is empty")
+	}
+	fx, fy := float64(w)/float64(b.Dx()), float64(h)/float64(b.Dy())
+	scaleTo := func(f float64) (int, int) {
+		return int(math.Max(1, math.Round(float64(b.Dx())*f))), int(math.Max(1, math.Round(float64(b.Dy())*f)))
+	}
+
+	// The backdrop: scaled to cover the canvas, with the overflow cut off evenly on both sides, then blurred.
+	cw, ch := scaleTo(math.Max(fx, fy))
+	backdrop, err := pad(transform.Resize(img, cw, ch, transform.Linear), w, h, color.Black, true)
+	if err != nil {
+		return nil, err
+	}
+	backdrop = gaussianBlur(backdrop, math.Max(float64(w), float64(h))/40)
+
+	// The sharp image: scaled to fit into the canvas.
+	fw, fh := scaleTo(math.Min(fx, fy))
+	front := transform.Resize(img, fw, fh, transform.Linear)
+	return compose(backdrop, front, image.Pt((w-fw)/2, (h-fh)/2)), nil
+}
+
+// placeholder returns a tiny, blurry `w` x `h` version of the image, to show on a web page while the real image loads. Sizes like 16x16 or 32x20 are typical; the browser stretches the placeholder to the size of the real image, and the blur keeps this from looking blocky.
+// `placeholderDataURI` returns the placeholder ready to be inlined into HTML.
+func placeholder(img image.Image, w, h int) (image.Image, error) {
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("placeholder(): size must be positive")
+	}
+	// The box filter averages all pixels that end up in the same target pixel. This is fast and exactly what we need for such a drastic reduction.
+	small := transform.Resize(img, w, h, transform.Box)
+	return gaussianBlur(small, 1), nil
+}
+
+// placeholderDataURI returns the placeholder for the image (see `placeholder`) as a data URI, which can go straight into the `src` attribute of an `img` tag. A 16x16 placeholder takes well under a kilobyte.
+func placeholderDataURI(img image.Image, w, h int) (string, error) {
+	p, err := placeholder(img, w, h)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = encodeImage(&buf, p, "png", SaveOptions{})
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// resizeThenSharpen scales the image to `w` x `h` using the given filter and then applies an unsharp mask of the given `amount`. This is the recommended order for thumbnails.
+// Downscaling averages neighboring pixels, which softens edges. Sharpening afterwards restores crisp edges at the final size.
+func resizeThenSharpen(img image.Image, w, h int, amount float64, filter transform.ResampleFilter) image.Image {
+	img = transform.Resize(img, w, h, filter)
+	return effect.UnsharpMask(img, 0.6, amount)
+}
+
+// sharpenThenResize does the same steps in the opposite order, for comparison. The downscaling step undoes most of the sharpening, and the thumbnail looks muddy.
+func sharpenThenResize(img image.Image, w, h int, amount float64, filter transform.ResampleFilter) image.Image {
+	img = effect.UnsharpMask(img, 0.6, amount)
+	return transform.Resize(img, w, h, filter)
+}
+
+// resizeStream reads an image from `r`, scales it down to fit into `maxW` x `maxH`, and writes it to `out` in the given format ("jpeg", "png", "gif", or "webp"). This is the typical job of an upload handler or an image proxy, which should not need hundreds of megabytes to turn a 100-megapixel photo into a thumbnail.
+// JPEG input takes a fast path: internal/jpegdec decodes it right away at 1/2, 1/4, or 1/8 of the full size (see `jpegScale`), so the full-size pixels never exist in memory, and the final resize only covers the remaining factor of less than 2. Progressive JPEGs save less, as the decoder holds the DCT coefficients of all blocks until the last scan. All other formats are decoded at full size first.
+// Either way, images above `MaxPixels` fail before anything is decoded.
+func resizeStream(r io.Reader, maxW, maxH int, out io.Writer, format string) error {
+	if maxW <= 0 || maxH <= 0 {
+		return errors.New("resizeStream(): maximum dimensions must be positive")
+	}
+	cfg, inFormat, r, err := peekConfig(r)
+	if err != nil {
+		return errors.Wrap(err, "resizeStream()")
+	}
+	if err := checkMaxPixels(cfg); err != nil {
+		return errors.Wrap(err, "resizeStream()")
+	}
+
+	w, h := fitSize(cfg.Width, cfg.Height, maxW, maxH, false)
+	var img image.Image
+	if inFormat == "jpeg" {
+		img, err = jpegdec.DecodeScaled(r, jpegScale(cfg.Width, cfg.Height, w, h))
+	} else {
+		img, _, err = image.Decode(r)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Decoding the image failed.")
+	}
+	if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+		img = transform.Resize(img, w, h, transform.Linear)
+	}
+
+	return encodeImage(out, img, format, defaultSaveOptions)
+}
+
+// jpegScale returns the largest of the JPEG decoding scales 1, 2, 4, and 8 at which a `width` x `height` image is still at least `minW` x `minH`, so that the final resize never has to enlarge it.
+func jpegScale(width, height, minW, minH int) int {
+	for _, s := range []int{8, 4, 2} {
+		if (width+s-1)/s >= minW && (height+s-1)/s >= minH {
+			return s
+		}
+	}
+	return 1
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+func TestResizeStream(t *testing.T) {
+	img := colorGradient(400, 200)
+	var in bytes.Buffer
+	if err := png.Encode(&in, img); err != nil {
+		t.Fatal(err)
+	}
+	baseline := encode(t, img, "jpeg", SaveOptions{Quality: 95})
+	progressive := encode(t, img, "jpeg", SaveOptions{Quality: 95, Progressive: true})
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"png", in.Bytes()},
+		{"baseline jpeg", baseline},
+		{"progressive jpeg", progressive},
+	} {
+		var out bytes.Buffer
+		if err := resizeStream(bytes.NewReader(tc.data), 100, 100, &out, "png"); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, format, err := image.Decode(&out)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if b := got.Bounds(); format != "png" || b.Dx() != 100 || b.Dy() != 50 {
+			t.Errorf("%s: got a %dx%d %s image, want a 100x50 png image", tc.name, b.Dx(), b.Dy(), format)
+		}
+		// The scaled JPEG decoding must not change the picture.
+		want := transform.Resize(img, 100, 50, transform.Linear)
+		if d := meanLuminance(got) - meanLuminance(want); d < -2 || d > 2 {
+			t.Errorf("%s: mean luminance differs by %.1f from decode-then-resize", tc.name, d)
+		}
+	}
+
+	// The size limit applies before decoding.
+	defer func(old int) { MaxPixels = old }(MaxPixels)
+	MaxPixels = 1000
+	for _, data := range [][]byte{in.Bytes(), baseline} {
+		if err := resizeStream(bytes.NewReader(data), 100, 100, ioutil.Discard, "png"); err == nil {
+			t.Error("image above MaxPixels: want an error")
+		}
+	}
+}
+
+func TestJPEGScale(t *testing.T) {
+	for _, tc := range []struct {
+		w, h, minW, minH, want int
+	}{
+		{4000, 3000, 400, 300, 8},
+		{4000, 3000, 501, 300, 4},
+		{4000, 3000, 2000, 1500, 2},
+		{4000, 3000, 2001, 1500, 1},
+		// Partial blocks count as a full pixel at the reduced size.
+		{4001, 3001, 501, 376, 8},
+	} {
+		if got := jpegScale(tc.w, tc.h, tc.minW, tc.minH); got != tc.want {
+			t.Errorf("jpegScale(%d, %d, %d, %d) = %d, want %d", tc.w, tc.h, tc.minW, tc.minH, got, tc.want)
+		}
+	}
+}
+
+// BenchmarkResizeStream compares resizeStream with decoding at full size and resizing afterwards. The allocations per operation show the memory that the scaled JPEG decoding saves.
+func BenchmarkResizeStream(b *testing.B) {
+	var in bytes.Buffer
+	if err := jpeg.Encode(&in, colorGradient(4000, 3000), nil); err != nil {
+		b.Fatal(err)
+	}
+	data := in.Bytes()
+
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := resizeStream(bytes.NewReader(data), 320, 320, ioutil.Discard, "jpeg"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decode-then-resize", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			img, _, err := decodeImage(bytes.NewReader(data))
+			if err != nil {
+				b.Fatal(err)
+			}
+			img = resizeFit(img, 320, 320, transform.Linear, false)
+			if err := encodeImage(ioutil.Discard, img, "jpeg", defaultSaveOptions); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// acutance sums up the squared differences of horizontally adjacent pixels in the middle row of the image. The crisper the edges, the larger the sum.
+func acutance(img image.Image) float64 {
+	b := img.Bounds()
+	y := b.Min.Y + b.Dy()/2
+	sum := 0.0
+	for x := b.Min.X + 1; x < b.Max.X; x++ {
+		r1, _, _, _ := img.At(x-1, y).RGBA()
+		r2, _, _, _ := img.At(x, y).RGBA()
+		d := float64(r2>>8) - float64(r1>>8)
+		sum += d * d
+	}
+	return sum
+}
+
+func TestSharpenOrder(t *testing.T) {
+	// A vertical edge from dark to light gray, away from the pixel grid of the thumbnail.
+	img := solidImage(202, 40, color.Gray{60})
+	draw.Draw(img, image.Rect(103, 0, 202, 40), &image.Uniform{color.Gray{190}}, image.Point{}, draw.Src)
+
+	before := acutance(sharpenThenResize(img, 50, 10, 1.5, transform.Linear))
+	after := acutance(resizeThenSharpen(img, 50, 10, 1.5, transform.Linear))
+	if after <= before {
+		t.Errorf("acutance of resize-then-sharpen (%.0f) is not above sharpen-then-resize (%.0f)", after, before)
+	}
+}
+
+// grayPixels returns the number of pixels that are neither black nor white.
+func grayPixels(img image.Image) int {
+	b := img.Bounds()
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r != 0 && r != 0xffff {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestResizeFitFilter(t *testing.T) {
+	img := checkerboard(90, 90, 3)
+	if n := grayPixels(resizeFit(img, 60, 60, transform.NearestNeighbor, false)); n != 0 {
+		t.Errorf("NearestNeighbor: %d gray pixels, want hard edges only", n)
+	}
+	if n := grayPixels(resizeFit(img, 60, 60, transform.Linear, false)); n == 0 {
+		t.Error("Linear: no gray pixels, want blurred edges")
+	}
+}
+
+func TestResizeFitUpscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+	img.SetRGBA(1, 0, color.RGBA{0, 255, 0, 255})
+	img.SetRGBA(0, 1, color.RGBA{0, 0, 255, 255})
+	img.SetRGBA(1, 1, color.RGBA{255, 255, 255, 255})
+
+	if out := resizeFit(img, 8, 8, transform.NearestNeighbor, false); out != image.Image(img) {
+		t.Errorf("without upscale: got size %v, want the image unchanged", out.Bounds().Size())
+	}
+
+	out := resizeFit(img, 8, 8, transform.NearestNeighbor, true)
+	if got := out.Bounds().Size(); got != image.Pt(8, 8) {
+		t.Fatalf("got size %v, want (8,8)", got)
+	}
+	// Each source pixel becomes a flat 4x4 block.
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			want := img.At(x/4, y/4)
+			if rgb(out.At(x, y)) != rgb(want) {
+				t.Fatalf("pixel (%d,%d): got %v, want %v", x, y, out.At(x, y), want)
+			}
+		}
+	}
+}
+
+// rgb returns the R, G, and B channels of `c`, for comparing colors of different color models.
+func rgb(c color.Color) [3]uint32 {
+	r, g, b, _ := c.RGBA()
+	return [3]uint32{r, g, b}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		factor float64
+		want   image.Point
+	}{
+		{100, 60, 0.5, image.Pt(50, 30)},
+		{101, 61, 0.5, image.Pt(51, 31)},
+		{10, 6, 3, image.Pt(30, 18)},
+		{10, 6, 0.01, image.Pt(1, 1)},
+	}
+	for _, tt := range tests {
+		out, err := scale(grayGradient(tt.w, tt.h), tt.factor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.Bounds().Size(); got != tt.want {
+			t.Errorf("scale(%dx%d, %v): got %v, want %v", tt.w, tt.h, tt.factor, got, tt.want)
+		}
+	}
+	if _, err := scale(grayGradient(10, 10), 0); err == nil {
+		t.Error("factor 0: want an error")
+	}
+}
+
+func TestCoverBackground(t *testing.T) {
+	out, err := coverBackground(checkerboard(100, 100, 4), 300, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Bounds().Size(); got != image.Pt(300, 100) {
+		t.Fatalf("got size %v, want (300,100)", got)
+	}
+	// The sharp image sits in the middle third; the bars on the left and right show the blurred backdrop.
+	rgba := toRGBA(out)
+	center := acutance(rgba.SubImage(image.Rect(120, 20, 180, 80)))
+	for _, corner := range []image.Rectangle{image.Rect(0, 0, 40, 40), image.Rect(260, 60, 300, 100)} {
+		if a := acutance(rgba.SubImage(corner)); a >= center/2 {
+			t.Errorf("corner %v: acutance %.1f, want much blurrier than the center (%.1f)", corner, a, center)
+		}
+	}
+
+	if _, err := coverBackground(checkerboard(10, 10, 2), 0, 100); err == nil {
+		t.Error("canvas width 0: want an error")
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	img := checkerboard(200, 160, 2)
+	p, err := placeholder(img, 16, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Bounds().Size(); got != image.Pt(16, 12) {
+		t.Errorf("got size %v, want (16,12)", got)
+	}
+	// The fine checkerboard averages out to a flat gray.
+	if lo, hi := lumRange(p); hi-lo > 20 {
+		t.Errorf("gray values range from %d to %d, want a low-detail image", lo, hi)
+	}
+
+	uri, err := placeholderDataURI(img, 16, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "data:image/png;base64,") || len(uri) > 1024 {
+		t.Errorf("got a data URI of %d bytes starting with %.30q, want a PNG data URI below 1 KB", len(uri), uri)
+	}
+	if _, err := placeholder(img, 0, 12); err == nil {
+		t.Error("width 0: want an error")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/pkg/errors"
+)
+
+// rotate rotates the image by `angle` degrees clockwise. The canvas grows to fit the whole rotated image; the corners that the image does not cover are transparent.
+// Use `autoTrim` to remove any uniform border that remains, or `cropAround` to cut out a fully covered area.
+func rotate(img image.Image, angle float64) image.Image {
+	return transform.Rotate(img, angle, &transform.RotationOptions{ResizeBounds: true})
+}
+
+// orientTo turns the image into landscape format (wider than high) if `landscape` is true, or into portrait format otherwise, by rotating it 90 degrees clockwise. An image that already has the requested orientation, or is square, is returned unchanged. This normalizes a mixed batch before it goes into a grid like `contactSheet`.
+func orientTo(img image.Image, landscape bool) image.Image {
+	b := img.Bounds()
+	if b.Dx() == b.Dy() || (b.Dx() > b.Dy()) == landscape {
+		return img
+	}
+	return rotate90(img)
+}
+
+// rotate90 rotates the image by 90 degrees clockwise. Unlike `rotate`, it just moves the pixels around, so the result is exact and has no transparent corners. The result starts at (0,0).
+func rotate90(img image.Image) *image.RGBA {
+	src := toRGBA(img)
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.SetRGBA(b.Dy()-1-y, x, src.RGBAAt(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// autoTrim removes a uniform border from the image, for example a transparent or white frame. The color of the top-left pixel defines the border color. Rows and columns whose pixels all lie within `tolerance` of that color (see `colorDistance`) are cut off.
+// An image that consists of border color only is returned unchanged.
+func autoTrim(img image.Image, tolerance float64) image.Image {
+	b := img.Bounds()
+	if b.Empty() {
+		return img
+	}
+	border := img.At(b.Min.X, b.Min.Y)
+	isBorder := func(x, y int) bool {
+		return colorDistance(img.At(x, y), border) <= tolerance
+	}
+	rowIsBorder := func(y, x0, x1 int) bool {
+		for x := x0; x < x1; x++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	colIsBorder := func(x, y0, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Shrink the rectangle from all four sides as long as the outermost row or column is border.
+	r := b
+	for r.Min.Y < r.Max.Y && rowIsBorder(r.Min.Y, r.Min.X, r.Max.X) {
+		r.Min.Y++
+	}
+	if r.Empty() {
+		return img
+	}
+	for rowIsBorder(r.Max.Y-1, r.Min.X, r.Max.X) {
+		r.Max.Y--
+	}
+	for colIsBorder(r.Min.X, r.Min.Y, r.Max.Y) {
+		r.Min.X++
+	}
+	for colIsBorder(r.Max.X-1, r.Min.Y, r.Max.Y) {
+		r.Max.X--
+	}
+	return subImage(img, r)
+}
+
+// trimBorders removes uniform borders, like the black or white margins of a scanned photo, before the image goes to `crop`. Unlike `autoTrim`, it does not assume a single border color: Each outermost row or column is cut off as long as all of its pixels lie within `tolerance` of its first pixel (see `colorDistance`), so each side can have a different color.
+// An image that consists of uniform rows or columns only is returned unchanged.
+func trimBorders(img image.Image, tolerance float64) image.Image {
+	b := img.Bounds()
+	uniform := func(x0, y0, dx, dy, n int) bool {
+		first := img.At(x0, y0)
+		for i := 1; i < n; i++ {
+			if colorDistance(img.At(x0+i*dx, y0+i*dy), first) > tolerance {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Where two borders of different colors meet, the rows of one border are only uniform once the other border is gone. So we keep going around until no side changes anymore.
+	r := b
+	for trimmed := true; trimmed && !r.Empty(); {
+		trimmed = false
+		switch {
+		case uniform(r.Min.X, r.Min.Y, 1, 0, r.Dx()):
+			r.Min.Y++
+		case uniform(r.Min.X, r.Max.Y-1, 1, 0, r.Dx()):
+			r.Max.Y--
+		case uniform(r.Min.X, r.Min.Y, 0, 1, r.Dy()):
+			r.Min.X++
+		case uniform(r.Max.X-1, r.Min.Y, 0, 1, r.Dy()):
+			r.Max.X--
+		default:
+			continue
+		}
+		trimmed = true
+	}
+	if r.Empty() {
+		return img
+	}
+	return subImage(img, r)
+}
+
+// subImage returns the part of the image within `r`. Images that do not implement `SubImager` are copied first.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if si, ok := img.(SubImager); ok {
+		return si.SubImage(r)
+	}
+	return toRGBA(img).SubImage(r)
+}
+
+// deskew straightens a scanned document: It detects how far the lines of text (or any other dominant horizontal lines) are tilted, rotates the image to correct that, and returns the angle it rotated by, in degrees clockwise.
+// The detection only considers angles of up to ±15°. For each candidate angle, deskew projects the dark pixels onto the vertical axis, as if the image were rotated by that angle. When the lines are level, the projection has sharp peaks (the lines) and deep valleys (the gaps between them), so the angle with the most "peaky" projection wins. This is a cheap relative of the Hough transform that works well for text.
+func deskew(img image.Image) (image.Image, float64, error) {
+	const maxAngle = 15.0
+
+	points := inkPixels(img, 20000)
+	if len(points) == 0 {
+		return nil, 0, errors.New("deskew(): image has no contrast")
+	}
+
+	// Search coarsely first, then refine around the best coarse angle.
+	best := bestProjectionAngle(points, -maxAngle, maxAngle, 0.5)
+	best = bestProjectionAngle(points, math.Max(-maxAngle, best-0.5), math.Min(maxAngle, best+0.5), 0.05)
+	if best == 0 {
+		return img, 0, nil
+	}
+	return rotate(img, best), best, nil
+}
+
+// straightenHorizon levels a tilted landscape photo: It detects the dominant near-horizontal edge, like the horizon or the shoreline, rotates the image to make it level, and crops the result to the largest area with the original aspect ratio that the rotated image covers completely, so there are no empty corners.
+// The detection works like in `deskew`, but it projects the pixels with the strongest vertical contrast instead of dark pixels, and only considers tilts of up to ±10°.
+func straightenHorizon(img image.Image) (image.Image, error) {
+	const maxAngle = 10.0
+
+	points := edgePixels(img, 20000)
+	if len(points) == 0 {
+		return nil, errors.New("straightenHorizon(): image has no edges")
+	}
+	angle := bestProjectionAngle(points, -maxAngle, maxAngle, 0.5)
+	angle = bestProjectionAngle(points, math.Max(-maxAngle, angle-0.5), math.Min(maxAngle, angle+0.5), 0.05)
+	if angle == 0 {
+		return img, nil
+	}
+
+	// The largest rectangle of the original aspect ratio that fits into the rotated image: Rotated back, its bounding box must fit into the original size.
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	sin, cos := math.Sincos(math.Abs(angle) * math.Pi / 180)
+	f := math.Min(w/(w*cos+h*sin), h/(w*sin+h*cos))
+
+	rotated := rotate(img, angle)
+	rect, err := centerRect(rotated.Bounds(), int(w*f), int(h*f))
+	if err != nil {
+		return nil, err
+	}
+	return subImage(rotated, rect), nil
+}
+
+// edgePixels returns the positions of the pixels with the strongest vertical contrast, relative to the image's top-left corner: about 2% of all pixels (fewer if the rest is flat), but at most about `limit`.
+func edgePixels(img image.Image, limit int) []image.Point {
+	b := img.Bounds()
+	if b.Dy() < 3 {
+		return nil
+	}
+	gray := image.NewGray(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+
+	// Compute the vertical gradient of each pixel and a histogram of the gradients, to find the threshold for the top 2%.
+	grad := make([]uint8, b.Dx()*b.Dy())
+	var hist [256]int
+	for y := b.Min.Y + 1; y < b.Max.Y-1; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			d := int(gray.GrayAt(x, y+1).Y) - int(gray.GrayAt(x, y-1).Y)
+			if d < 0 {
+				d = -d
+			}
+			g := uint8(d / 2)
+			grad[(y-b.Min.Y)*b.Dx()+x-b.Min.X] = g
+			hist[g]++
+		}
+	}
+	level := maxInt(percentile(hist, 0.98), 1)
+
+	var points []image.Point
+	for i, g := range grad {
+		if int(g) >= level {
+			points = append(points, image.Pt(i%b.Dx(), i/b.Dx()))
+		}
+	}
+	return thinPoints(points, limit)
+}
+
+// inkPixels returns the positions of roughly up to `limit` pixels that belong to the foreground, relative to the image's top-left corner. The foreground is whichever side of the Otsu threshold (see `otsuLevel`) has fewer pixels, which is the text on both dark-on-light and light-on-dark documents.
+func inkPixels(img image.Image, limit int) []image.Point {
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+	level := otsuLevel(gray)
+
+	var dark, light []image.Point
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := image.Pt(x-b.Min.X, y-b.Min.Y)
+			if gray.GrayAt(x, y).Y < level {
+				dark = append(dark, p)
+			} else {
+				light = append(light, p)
+			}
+		}
+	}
+	if len(light) == 0 || len(dark) == 0 {
+		return nil
+	}
+	ink := dark
+	if len(light) < len(dark) {
+		ink = light
+	}
+
+	return thinPoints(ink, limit)
+}
+
+// thinPoints keeps only every n-th point, so that about `limit` points remain. The projections of `bestProjectionAngle` stay just as peaky.
+func thinPoints(points []image.Point, limit int) []image.Point {
+	n := len(points) / limit
+	if n <= 1 {
+		return points
+	}
+	thinned := make([]image.Point, 0, len(points)/n+1)
+	for i := 0; i < len(points); i += n {
+		thinned = append(thinned, points[i])
+	}
+	return thinned
+}
+
+// bestProjectionAngle tries all angles from `from` to `to` in steps of `step` degrees and returns the one at which the points, rotated clockwise by that angle, line up best in rows.
+// The score of an angle is the sum of the squared row counts of the projection, which grows as the points crowd into fewer rows. Ties go to the angle closest to 0.
+func bestProjectionAngle(points []image.Point, from, to, step float64) float64 {
+	best, bestScore := 0.0, -1.0
+	steps := int(math.Round((to - from) / step))
+	for i := 0; i <= steps; i++ {
+		angle := from + float64(i)*step
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+
+		rows := make(map[int]int)
+		for _, p := range points {
+			rows[int(math.Floor(float64(p.X)*sin+float64(p.Y)*cos))]++
+		}
+		score := 0.0
+		for _, n := range rows {
+			score += float64(n) * float64(n)
+		}
+		if score > bestScore || (score == bestScore && math.Abs(angle) < math.Abs(best)) {
+			best, bestScore = angle, score
+		}
+	}
+	return best
+}
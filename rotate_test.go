@@ -0,0 +1,151 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// framed returns a 40x30 color gradient within a 10px border of `c`.
+func framed(c color.Color) *image.RGBA {
+	img := solidImage(60, 50, c)
+	draw.Draw(img, image.Rect(10, 10, 50, 40), colorGradient(40, 30), image.Point{}, draw.Src)
+	return img
+}
+
+func TestAutoTrim(t *testing.T) {
+	out := autoTrim(framed(color.White), 0.01)
+	if want := image.Rect(10, 10, 50, 40); out.Bounds() != want {
+		t.Errorf("got bounds %v, want %v", out.Bounds(), want)
+	}
+
+	plain := solidImage(20, 20, color.White)
+	if out := autoTrim(plain, 0.01); out.Bounds() != plain.Bounds() {
+		t.Errorf("border-only image: got bounds %v, want it unchanged", out.Bounds())
+	}
+}
+
+// tiltedLines returns a white 200x200 image with black, 3px thick lines that rise to the right by `angle` degrees, like a scan that is rotated counterclockwise.
+func tiltedLines(angle float64) *image.RGBA {
+	img := solidImage(200, 200, color.White)
+	tan := math.Tan(angle * math.Pi / 180)
+	for c := 30; c < 200; c += 20 {
+		for x := 0; x < 200; x++ {
+			y0 := int(math.Round(float64(c) - float64(x)*tan))
+			for y := y0; y < y0+3; y++ {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func TestDeskew(t *testing.T) {
+	for _, want := range []float64{5, -8, 0} {
+		out, angle, err := deskew(tiltedLines(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(angle-want) > 0.3 {
+			t.Errorf("lines tilted by %v°: got an angle of %.2f°", want, angle)
+		}
+		if out == nil {
+			t.Errorf("lines tilted by %v°: got no image", want)
+		}
+	}
+
+	if _, _, err := deskew(solidImage(50, 50, color.White)); err == nil {
+		t.Error("blank page: want an error")
+	}
+}
+
+func TestTrimBorders(t *testing.T) {
+	if out := trimBorders(framed(color.White), 0.01); out.Bounds() != image.Rect(10, 10, 50, 40) {
+		t.Errorf("white border: got bounds %v, want (10,10)-(50,40)", out.Bounds())
+	}
+
+	// White at the top and left, black at the bottom and right.
+	img := framed(color.White)
+	draw.Draw(img, image.Rect(0, 40, 60, 50), &image.Uniform{color.Black}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(50, 0, 60, 50), &image.Uniform{color.Black}, image.Point{}, draw.Src)
+	if out := trimBorders(img, 0.01); out.Bounds() != image.Rect(10, 10, 50, 40) {
+		t.Errorf("two-colored border: got bounds %v, want (10,10)-(50,40)", out.Bounds())
+	}
+
+	plain := solidImage(20, 20, color.White)
+	if out := trimBorders(plain, 0.01); out.Bounds() != plain.Bounds() {
+		t.Errorf("uniform image: got bounds %v, want it unchanged", out.Bounds())
+	}
+}
+
+// horizonRow returns the first row in column `x` that is darker than mid gray.
+func horizonRow(img image.Image, x int) int {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128 {
+			return y - b.Min.Y
+		}
+	}
+	return -1
+}
+
+func TestStraightenHorizon(t *testing.T) {
+	// Bright sky over a dark sea, with a horizon that rises to the right by 4 degrees.
+	img := solidImage(300, 200, color.RGBA{200, 220, 255, 255})
+	tan := math.Tan(4 * math.Pi / 180)
+	for x := 0; x < 300; x++ {
+		top := int(math.Round(100 - float64(x-150)*tan))
+		draw.Draw(img, image.Rect(x, top, x+1, 200), &image.Uniform{color.RGBA{20, 40, 80, 255}}, image.Point{}, draw.Src)
+	}
+	if left, right := horizonRow(img, 60), horizonRow(img, 240); left-right < 10 {
+		t.Fatalf("test image: horizon at rows %d and %d, want a tilt", left, right)
+	}
+
+	out, err := straightenHorizon(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := out.Bounds()
+	if left, right := horizonRow(out, b.Min.X+b.Dx()/5), horizonRow(out, b.Min.X+b.Dx()*4/5); left < 0 || math.Abs(float64(left-right)) > 2 {
+		t.Errorf("horizon at rows %d and %d, want it level", left, right)
+	}
+	// The crop removes the empty corners of the rotated image.
+	for _, p := range []image.Point{b.Min, {b.Max.X - 1, b.Max.Y - 1}} {
+		if _, _, _, a := out.At(p.X, p.Y).RGBA(); a != 0xffff {
+			t.Errorf("corner %v is not opaque", p)
+		}
+	}
+	if r := float64(b.Dx()) / float64(b.Dy()); math.Abs(r-1.5) > 0.02 {
+		t.Errorf("got aspect ratio %.3f, want 1.5", r)
+	}
+}
+
+func TestOrientTo(t *testing.T) {
+	portrait := solidImage(20, 40, color.White)
+	portrait.Set(0, 0, color.RGBA{255, 0, 0, 255})
+
+	out := orientTo(portrait, true)
+	if got := out.Bounds().Size(); got != image.Pt(40, 20) {
+		t.Fatalf("portrait to landscape: got size %v, want (40,20)", got)
+	}
+	// Turning clockwise moves the top-left corner to the top-right.
+	if got := color.RGBAModel.Convert(out.At(39, 0)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("top-right pixel is %v, want the red top-left pixel of the input", got)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		img       image.Image
+		landscape bool
+	}{
+		{"portrait to portrait", portrait, false},
+		{"landscape to landscape", solidImage(40, 20, color.White), true},
+		{"square", solidImage(30, 30, color.White), true},
+	} {
+		if out := orientTo(tc.img, tc.landscape); out != tc.img {
+			t.Errorf("%s: want the image unchanged", tc.name)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+/*
+`smartcrop` decides where to crop by rating each pixel's "interestingness". `artyom/smartcrop` keeps this importance map to itself, so the functions here rebuild it along the lines of the original smartcrop.js algorithm. Three features make a pixel interesting:
+
+* edges (detail): the Laplacian of the pixel's luminance,
+* skin: how close the pixel's color is to a typical skin tone,
+* saturation: strongly saturated colors that are neither too dark nor too bright.
+*/
+
+// energyWeights controls how much each feature contributes to the energy of a pixel.
+type energyWeights struct {
+	Edge, Skin, Saturation float64
+}
+
+// defaultEnergyWeights resemble the weighting of smartcrop.js.
+var defaultEnergyWeights = energyWeights{Edge: 0.2, Skin: 1.8, Saturation: 0.3}
+
+// energyMap holds one energy value per pixel, row by row. Coordinates are relative to the image's top-left corner, which is at `origin`.
+type energyMap struct {
+	w, h   int
+	v      []float64
+	origin image.Point
+}
+
+func (e *energyMap) at(x, y int) float64 {
+	return e.v[y*e.w+x]
+}
+
+// max returns the largest energy value in the map.
+func (e *energyMap) max() float64 {
+	m := 0.0
+	for _, v := range e.v {
+		m = math.Max(m, v)
+	}
+	return m
+}
+
+// computeEnergy calculates the energy map of the image using the given weights.
+func computeEnergy(img image.Image, wt energyWeights) *energyMap {
+	rgba := toRGBA(img)
+	b := rgba.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// Precompute the luminance of each pixel for edge detection.
+	lum := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := rgba.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			lum[y*w+x] = (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 255
+		}
+	}
+	lumAt := func(x, y int) float64 {
+		// Extend the image at the borders.
+		x = clampInt(x, 0, w-1)
+		y = clampInt(y, 0, h-1)
+		return lum[y*w+x]
+	}
+
+	e := &energyMap{w: w, h: h, v: make([]float64, w*h), origin: b.Min}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := rgba.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			r, g, bl := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+			l := lum[y*w+x]
+
+			edge := math.Abs(4*l - lumAt(x-1, y) - lumAt(x+1, y) - lumAt(x, y-1) - lumAt(x, y+1))
+			e.v[y*w+x] = wt.Edge*math.Min(edge, 1) + wt.Skin*skinScore(r, g, bl, l) + wt.Saturation*saturationScore(r, g, bl, l)
+		}
+	}
+	return e
+}
+
+// skinScore rates how close the color is to a typical skin tone, from 0 to 1.
+func skinScore(r, g, b, lum float64) float64 {
+	const threshold = 0.8
+	if lum < 0.2 {
+		return 0
+	}
+	mag := math.Sqrt(r*r + g*g + b*b)
+	if mag == 0 {
+		return 0
+	}
+	rd, gd, bd := r/mag-0.78, g/mag-0.57, b/mag-0.44
+	skin := 1 - math.Sqrt(rd*rd+gd*gd+bd*bd)
+	if skin < threshold {
+		return 0
+	}
+	return (skin - threshold) / (1 - threshold)
+}
+
+// saturationScore rates the HSL saturation of the color, from 0 to 1. Weak saturation as well as very dark or very bright pixels do not count.
+func saturationScore(r, g, b, lum float64) float64 {
+	const threshold = 0.4
+	if lum < 0.05 || lum > 0.9 {
+		return 0
+	}
+	hi := math.Max(r, math.Max(g, b))
+	lo := math.Min(r, math.Min(g, b))
+	if hi == lo {
+		return 0
+	}
+	d := hi - lo
+	sat := d / (hi + lo)
+	if (hi+lo)/2 > 0.5 {
+		sat = d / (2 - hi - lo)
+	}
+	if sat < threshold {
+		return 0
+	}
+	return (sat - threshold) / (1 - threshold)
+}
+
+// clampInt limits v to the range [lo, hi].
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// cropHeatmap renders the energy map that drives the crop as a grayscale image of the same size as `img`. The brighter a pixel, the more it attracts the crop.
+// This helps to understand why `crop` picked a particular area.
+func cropHeatmap(img image.Image) (image.Image, error) {
+	if img.Bounds().Empty() {
+		return nil, errors.New("cropHeatmap(): image is empty")
+	}
+
+	e := computeEnergy(img, defaultEnergyWeights)
+	heat := image.NewGray(img.Bounds())
+
+	// Scale the energy so that the most interesting pixel becomes white.
+	scale := 0.0
+	if m := e.max(); m > 0 {
+		scale = 255 / m
+	}
+	for i, v := range e.v {
+		heat.Pix[i] = uint8(math.Round(v * scale))
+	}
+	return heat, nil
+}
+
+// cutout keeps the main subject of the image and makes the background transparent, for putting a product or a logo onto a different background with `compose`. The result has the same size as `img`; `trimBorders` with a tolerance of 0 cuts away the transparent margins.
+// It uses the energy map that also drives the crop: Pixels above the Otsu threshold (see `otsuLevel`) of the energy form the outline of the subject, and every pixel that can be reached from the image border without crossing the outline is background. So the subject can be plain inside, as long as its outline is closed.
+// This is no match for machine-learning background removal. It works for a clearly outlined subject on a plain or smooth background, like a studio shot. A busy background, a subject that blends into the background or touches the image border, and holes in the subject (like the space between arm and body) all end up in the wrong class. Without anything that stands out, cutout returns an error.
+func cutout(img image.Image) (image.Image, error) {
+	b := img.Bounds()
+	if b.Empty() {
+		return nil, errors.New("cutout(): image is empty")
+	}
+
+	e := computeEnergy(img, defaultEnergyWeights)
+	// A tiny maximum is just rounding noise of the edge detection on a plain image.
+	m := e.max()
+	if m < 1e-9 {
+		return nil, errors.New("cutout(): no subject found")
+	}
+	heat := image.NewGray(image.Rect(0, 0, e.w, e.h))
+	for i, v := range e.v {
+		heat.Pix[i] = uint8(math.Round(v * 255 / m))
+	}
+	level := otsuLevel(heat)
+	if level == 0 {
+		return nil, errors.New("cutout(): no subject found")
+	}
+
+	// Flood fill the background from all border pixels below the threshold.
+	background := make([]bool, e.w*e.h)
+	var queue []int
+	visit := func(x, y int) {
+		i := y*e.w + x
+		if !background[i] && heat.Pix[i] < level {
+			background[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for x := 0; x < e.w; x++ {
+		visit(x, 0)
+		visit(x, e.h-1)
+	}
+	for y := 0; y < e.h; y++ {
+		visit(0, y)
+		visit(e.w-1, y)
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		x, y := i%e.w, i/e.w
+		if x > 0 {
+			visit(x-1, y)
+		}
+		if x < e.w-1 {
+			visit(x+1, y)
+		}
+		if y > 0 {
+			visit(x, y-1)
+		}
+		if y < e.h-1 {
+			visit(x, y+1)
+		}
+	}
+
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	subject := 0
+	for i, bg := range background {
+		if bg {
+			dst.Pix[dst.PixOffset(b.Min.X+i%e.w, b.Min.Y+i/e.w)+3] = 0
+		} else {
+			subject++
+		}
+	}
+	if subject == 0 {
+		return nil, errors.New("cutout(): no subject found")
+	}
+	return dst, nil
+}
+
+// scoredRect is a candidate crop rectangle with its total energy.
+type scoredRect struct {
+	rect  image.Rectangle
+	score float64
+}
+
+// scanWindows slides a `width` x `height` window over the energy map and returns the total energy for each window position, in image coordinates.
+// On large images, the window moves in steps of a few pixels, which is precise enough for cropping and a lot faster.
+func scanWindows(e *energyMap, width, height int) []scoredRect {
+	if width > e.w || height > e.h || width <= 0 || height <= 0 {
+		return nil
+	}
+
+	// A summed-area table gives the energy of any rectangle in constant time.
+	sat := make([]float64, (e.w+1)*(e.h+1))
+	stride := e.w + 1
+	for y := 0; y < e.h; y++ {
+		rowSum := 0.0
+		for x := 0; x < e.w; x++ {
+			rowSum += e.at(x, y)
+			sat[(y+1)*stride+x+1] = sat[y*stride+x+1] + rowSum
+		}
+	}
+	sum := func(x0, y0, x1, y1 int) float64 {
+		return sat[y1*stride+x1] - sat[y0*stride+x1] - sat[y1*stride+x0] + sat[y0*stride+x0]
+	}
+
+	step := 1
+	if m := minInt(e.w, e.h); m > 200 {
+		step = m / 100
+	}
+	var windows []scoredRect
+	for y := 0; ; y += step {
+		// Make sure the window also visits the bottom and right edges.
+		y = minInt(y, e.h-height)
+		for x := 0; ; x += step {
+			x = minInt(x, e.w-width)
+			r := image.Rect(x, y, x+width, y+height).Add(e.origin)
+			windows = append(windows, scoredRect{r, sum(x, y, x+width, y+height)})
+			if x == e.w-width {
+				break
+			}
+		}
+		if y == e.h-height {
+			break
+		}
+	}
+	return windows
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of a and b.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestCropHeatmapSize(t *testing.T) {
+	img := colorGradient(60, 40)
+	heat, err := cropHeatmap(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heat.Bounds() != img.Bounds() {
+		t.Errorf("got bounds %v, want %v", heat.Bounds(), img.Bounds())
+	}
+}
+
+func TestCutout(t *testing.T) {
+	img := solidImage(60, 60, color.RGBA{200, 200, 200, 255})
+	draw.Draw(img, image.Rect(20, 20, 40, 40), &image.Uniform{color.RGBA{30, 30, 120, 255}}, image.Point{}, draw.Src)
+
+	out, err := cutout(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bounds() != img.Bounds() {
+		t.Fatalf("got bounds %v, want %v", out.Bounds(), img.Bounds())
+	}
+	for _, p := range []image.Point{{0, 0}, {59, 0}, {5, 30}, {30, 55}, {12, 12}} {
+		if _, _, _, a := out.At(p.X, p.Y).RGBA(); a != 0 {
+			t.Errorf("background pixel %v: got alpha %d, want 0", p, a>>8)
+		}
+	}
+	for _, p := range []image.Point{{30, 30}, {22, 22}, {37, 25}} {
+		if got := color.NRGBAModel.Convert(out.At(p.X, p.Y)); got != (color.NRGBA{30, 30, 120, 255}) {
+			t.Errorf("subject pixel %v: got %v, want the opaque original color", p, got)
+		}
+	}
+
+	if _, err := cutout(solidImage(60, 60, color.White)); err == nil {
+		t.Error("plain image: want an error")
+	}
+}
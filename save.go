@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/appliedgo/imageprocessing/internal/jpegenc"
+	"github.com/pkg/errors"
+)
+
+// SaveOptions controls how `encodeImage` and `saveImageAs` encode an image.
+type SaveOptions struct {
+	// Quality is the JPEG and WebP quality, from 1 to 100. 0 selects the default quality of `defaultSaveOptions`.
+	Quality int
+
+	// Subsampling sets the resolution of the color channels relative to the brightness channel. The default is `Subsampling420`, which is all that the standard library's encoder can write. For high-quality output, especially of graphics with colored text or sharp color edges, use `Subsampling444`.
+	// JPEG data is written by a copy of the standard library's encoder in internal/jpegenc that adds 4:2:2 and 4:4:4 support. It ignores the setting for grayscale images, which have no color channels.
+	Subsampling Subsampling
+
+	// Progressive writes a progressive JPEG (SOF2 marker) instead of a baseline one (SOF0 marker). Browsers show a progressive JPEG as a blurry preview that sharpens while the rest loads, which helps on slow connections. The default of false writes baseline JPEGs, like the standard library does.
+	// The encoder in internal/jpegenc splits the scans by frequency only, so the file decodes to exactly the same pixels as the baseline one. It also comes out slightly larger, whereas libjpeg's progressive JPEGs are often smaller than baseline ones thanks to successive approximation and optimized Huffman tables, which the encoder lacks.
+	Progressive bool
+
+	// Exif is a raw EXIF segment, as returned by `readExif`, to embed into the saved file. Only the descriptive fields are kept, and the dimensions and the orientation are updated (see `rewriteExif`). If nil, the file has no EXIF data.
+	Exif []byte
+
+	// ICCProfile is an ICC color profile, as returned by `readICCProfile`, to embed into the saved file. If nil, viewers assume sRGB.
+	ICCProfile []byte
+}
+
+// Subsampling is a JPEG chroma subsampling mode. The eye is much less sensitive to color detail than to brightness detail, so JPEG encoders usually store the color channels at a reduced resolution.
+// 4:2:0 halves the color resolution in both directions, which yields the smallest files but can make sharp color edges, like red text on blue, look smeared. 4:2:2 halves it horizontally only, and 4:4:4 keeps the full color resolution at the cost of noticeably larger files.
+type Subsampling int
+
+// The constants have the same values as those of jpegenc, so that `encodeImage` can convert them directly.
+const (
+	Subsampling420 Subsampling = iota
+	Subsampling422
+	Subsampling444
+)
+
+func (s Subsampling) String() string {
+	switch s {
+	case Subsampling420:
+		return "4:2:0"
+	case Subsampling422:
+		return "4:2:2"
+	case Subsampling444:
+		return "4:4:4"
+	}
+	return "unknown"
+}
+
+// defaultSaveOptions are the options `saveImage` uses.
+var defaultSaveOptions = SaveOptions{Quality: 85}
+
+// saveImageAs saves the image to `pname/fname`, using the given options. The file extension selects the format: ".png", ".gif", and ".webp" save as PNG, GIF, and WebP, respectively; everything else saves as JPEG.
+func saveImageAs(img image.Image, pname, fname string, opts SaveOptions) error {
+	fpath := path.Join(pname, fname)
+	format := formatFromName(fname)
+
+	f, err := os.Create(fpath)
+	if err != nil {
+		return errors.Wrap(err, "Cannot create file: "+fpath)
+	}
+	err = encodeImage(f, img, format, opts)
+	if err != nil {
+		// Do not leave a broken file behind.
+		f.Close()
+		os.Remove(fpath)
+		return err
+	}
+	return errors.Wrap(f.Close(), "Cannot close file: "+fpath)
+}
+
+// encodeImage writes the image to `w` in the given format ("jpeg", "png", "gif", or "webp"), so that it can go to an HTTP response or a buffer as well as to a file.
+// A `*image.Paletted` becomes an indexed-color PNG, which is much smaller than a truecolor PNG (see `saveIndexedPNG`). WebP encoding is only available in builds with `-tags webp` (see webp.go). Quality applies to JPEG and WebP; Subsampling and Progressive only apply to JPEG. An ICC profile can be embedded into JPEG and PNG data, EXIF data only into JPEG data; setting them for a format that cannot hold them is an error.
+func encodeImage(w io.Writer, img image.Image, format string, opts SaveOptions) error {
+	if opts.Quality == 0 {
+		opts.Quality = defaultSaveOptions.Quality
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg", "jpg":
+		if opts.Subsampling < Subsampling420 || opts.Subsampling > Subsampling444 {
+			return errors.Errorf("encodeImage(): invalid chroma subsampling %d", opts.Subsampling)
+		}
+		err = jpegenc.Encode(&buf, img, &jpegenc.Options{Quality: opts.Quality, Subsampling: jpegenc.Subsampling(opts.Subsampling), Progressive: opts.Progressive})
+	case "png":
+		if opts.Exif != nil {
+			return errors.New("encodeImage(): EXIF data can only be embedded into JPEG data")
+		}
+		err = png.Encode(&buf, img)
+	case "gif":
+		if opts.Exif != nil || opts.ICCProfile != nil {
+			return errors.New("encodeImage(): GIF data cannot hold EXIF data or ICC profiles")
+		}
+		err = gif.Encode(&buf, img, nil)
+	case "webp":
+		if opts.Exif != nil || opts.ICCProfile != nil {
+			return errors.New("encodeImage(): embedding EXIF data or ICC profiles into WebP data is not supported")
+		}
+		// encodeWebP wraps its own errors.
+		if err := encodeWebP(&buf, img, opts.Quality); err != nil {
+			return err
+		}
+	default:
+		return errors.New("encodeImage(): unsupported format " + format)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode the image as "+format)
+	}
+
+	data := buf.Bytes()
+	if format == "png" {
+		if opts.ICCProfile != nil {
+			data, err = embedICCInPNG(data, opts.ICCProfile)
+			if err != nil {
+				return err
+			}
+		}
+	} else if format == "jpeg" || format == "jpg" {
+		data, err = addJPEGMetadata(data, img.Bounds().Size(), opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write(data)
+	return errors.Wrap(err, "Cannot write the image data")
+}
+
+// formatFromName returns the image format that matches the extension of the file name, for `encodeImage`. Unknown extensions map to "jpeg".
+func formatFromName(fname string) string {
+	switch strings.ToLower(path.Ext(fname)) {
+	case ".png":
+		return "png"
+	case ".gif":
+		return "gif"
+	case ".webp":
+		return "webp"
+	}
+	return "jpeg"
+}
+
+// addJPEGMetadata inserts the ICC profile and the EXIF data from `opts`, if any, into the JPEG data of an image of the given size. The EXIF data is rewritten to match the new image (see `rewriteExif`).
+func addJPEGMetadata(data []byte, size image.Point, opts SaveOptions) ([]byte, error) {
+	if opts.ICCProfile != nil {
+		segs, err := iccSegments(opts.ICCProfile)
+		if err != nil {
+			return nil, err
+		}
+		data, err = insertSegment(data, segs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// EXIF goes in front of the ICC profile, as the EXIF standard wants APP1 to follow SOI directly.
+	if opts.Exif != nil {
+		exif, err := rewriteExif(opts.Exif, size)
+		if err != nil {
+			return nil, err
+		}
+		return insertSegment(data, exif)
+	}
+	return data, nil
+}
+
+// isProgressiveJPEG reports whether the JPEG data in `r` is progressive (SOF2 marker) rather than baseline (SOF0 or SOF1 marker), for example to check the output of `encodeImage` with `SaveOptions.Progressive`.
+func isProgressiveJPEG(r io.Reader) (bool, error) {
+	segs, err := jpegHeaderSegments(r)
+	if err != nil {
+		return false, errors.Wrap(err, "isProgressiveJPEG()")
+	}
+	for _, seg := range segs {
+		switch seg[1] {
+		case 0xc0, 0xc1:
+			return false, nil
+		case 0xc2:
+			return true, nil
+		}
+	}
+	return false, errors.New("isProgressiveJPEG(): scan data starts before the frame header")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"testing"
+)
+
+// encode encodes the image with `encodeImage` and fails the test on errors.
+func encode(t *testing.T, img image.Image, format string, opts SaveOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, img, format, opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeImageQuality(t *testing.T) {
+	img := colorGradient(64, 64)
+	zero := encode(t, img, "jpeg", SaveOptions{})
+	def := encode(t, img, "jpeg", defaultSaveOptions)
+	if !bytes.Equal(zero, def) {
+		t.Error("quality 0 does not select the default quality")
+	}
+	if low := encode(t, img, "jpeg", SaveOptions{Quality: 20}); len(low) >= len(def) {
+		t.Errorf("quality 20 yields %d bytes, want less than the %d bytes of the default quality", len(low), len(def))
+	}
+
+	progressive, err := isProgressiveJPEG(bytes.NewReader(zero))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progressive {
+		t.Error("got a progressive JPEG, want baseline")
+	}
+}
+
+func TestIsProgressiveJPEG(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+		err  bool
+	}{
+		{"baseline", []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00, 0xff, 0xc0, 0x00, 0x02, 0xff, 0xda}, false, false},
+		{"progressive", []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00, 0xff, 0xc2, 0x00, 0x02, 0xff, 0xda}, true, false},
+		{"fill bytes", []byte{0xff, 0xd8, 0xff, 0xff, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00, 0xff, 0xff, 0xc2, 0x00, 0x02, 0xff, 0xda}, true, false},
+		{"no frame header", []byte{0xff, 0xd8, 0xff, 0xda, 0x00, 0x02}, false, true},
+		{"no JPEG", []byte("GIF89a"), false, true},
+	}
+	for _, tt := range tests {
+		got, err := isProgressiveJPEG(bytes.NewReader(tt.data))
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%s: got %v, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestEncodeImageProgressive(t *testing.T) {
+	// An odd size leaves partial MCUs at the right and bottom edges.
+	img := colorGradient(37, 23)
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), img, image.Point{}, draw.Src)
+
+	for _, tc := range []struct {
+		name string
+		img  image.Image
+		s    Subsampling
+	}{
+		{"4:2:0", img, Subsampling420},
+		{"4:2:2", img, Subsampling422},
+		{"4:4:4", img, Subsampling444},
+		{"gray", gray, Subsampling420},
+	} {
+		for _, progressive := range []bool{false, true} {
+			data := encode(t, tc.img, "jpeg", SaveOptions{Subsampling: tc.s, Progressive: progressive})
+			got, err := isProgressiveJPEG(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if got != progressive {
+				t.Errorf("%s: Progressive %v yields a JPEG with progressive %v", tc.name, progressive, got)
+			}
+		}
+
+		// Both encodings hold the same coefficients, so they decode to the same pixels.
+		baseline, err := jpeg.Decode(bytes.NewReader(encode(t, tc.img, "jpeg", SaveOptions{Subsampling: tc.s})))
+		if err != nil {
+			t.Fatalf("%s baseline: %v", tc.name, err)
+		}
+		progressive, err := jpeg.Decode(bytes.NewReader(encode(t, tc.img, "jpeg", SaveOptions{Subsampling: tc.s, Progressive: true})))
+		if err != nil {
+			t.Fatalf("%s progressive: %v", tc.name, err)
+		}
+		if !samePixels(progressive, baseline) {
+			t.Errorf("%s: the progressive JPEG decodes to different pixels than the baseline one", tc.name)
+		}
+	}
+}
+
+func TestEncodeImageMatchesStdlib(t *testing.T) {
+	// Without options that the standard library lacks, the forked encoder writes the same bytes.
+	img := colorGradient(37, 23)
+	var want bytes.Buffer
+	if err := jpeg.Encode(&want, img, &jpeg.Options{Quality: defaultSaveOptions.Quality}); err != nil {
+		t.Fatal(err)
+	}
+	if got := encode(t, img, "jpeg", SaveOptions{}); !bytes.Equal(got, want.Bytes()) {
+		t.Error("baseline 4:2:0 output differs from image/jpeg")
+	}
+}
+
+func TestEncodeImageSubsampling(t *testing.T) {
+	// Colored stripes have lots of color detail that 4:2:0 throws away.
+	img := colorGradient(128, 128)
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x += 4 {
+			img.Set(x, y, color.RGBA{0, 0, 255, 255})
+		}
+	}
+	s420 := encode(t, img, "jpeg", SaveOptions{Subsampling: Subsampling420})
+	s444 := encode(t, img, "jpeg", SaveOptions{Subsampling: Subsampling444})
+	if len(s444) <= len(s420) {
+		t.Errorf("4:4:4 yields %d bytes, want more than the %d bytes of 4:2:0", len(s444), len(s420))
+	}
+	if err := encodeImage(ioutil.Discard, img, "jpeg", SaveOptions{Subsampling: Subsampling444 + 1}); err == nil {
+		t.Error("invalid subsampling: want an error")
+	}
+}
+
+func TestEncodeImageSamplingFactors(t *testing.T) {
+	img := colorGradient(64, 48)
+	for _, tc := range []struct {
+		s    Subsampling
+		want image.YCbCrSubsampleRatio
+	}{
+		{Subsampling420, image.YCbCrSubsampleRatio420},
+		{Subsampling422, image.YCbCrSubsampleRatio422},
+		{Subsampling444, image.YCbCrSubsampleRatio444},
+	} {
+		// The decoder picks the subsample ratio from the sampling factors in the SOF header.
+		out, err := jpeg.Decode(bytes.NewReader(encode(t, img, "jpeg", SaveOptions{Subsampling: tc.s})))
+		if err != nil {
+			t.Fatalf("%v: %v", tc.s, err)
+		}
+		ycc, ok := out.(*image.YCbCr)
+		if !ok {
+			t.Fatalf("%v: decoded as %T, want *image.YCbCr", tc.s, out)
+		}
+		if ycc.SubsampleRatio != tc.want {
+			t.Errorf("%v: got subsample ratio %v, want %v", tc.s, ycc.SubsampleRatio, tc.want)
+		}
+		if ycc.Bounds() != img.Bounds() {
+			t.Errorf("%v: got bounds %v, want %v", tc.s, ycc.Bounds(), img.Bounds())
+		}
+	}
+}
+
+func TestEncodeImageRoundTrip(t *testing.T) {
+	img := colorGradient(40, 30)
+	for _, format := range []string{"png", "jpeg", "gif"} {
+		out, got, err := image.Decode(bytes.NewReader(encode(t, img, format, SaveOptions{})))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got != format {
+			t.Errorf("%s: decoded as %s", format, got)
+		}
+		if out.Bounds().Size() != img.Bounds().Size() {
+			t.Errorf("%s: got size %v, want %v", format, out.Bounds().Size(), img.Bounds().Size())
+		}
+		if format == "png" && !samePixels(out, img) {
+			t.Error("png: the pixels changed")
+		}
+	}
+
+	if err := encodeImage(ioutil.Discard, img, "bmp", SaveOptions{}); err == nil {
+		t.Error("unsupported format: want an error")
+	}
+}
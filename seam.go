@@ -0,0 +1,97 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// seamCarve shrinks the image to `newW` x `newH` by repeatedly removing the seam with the least energy (see `computeEnergy`). A seam is a connected path of pixels from top to bottom (or left to right) with one pixel per row (or column).
+// Unlike a plain resize, seam carving takes pixels away from boring areas like sky or lawn and leaves the interesting parts undistorted, which makes it a good choice for aggressive changes of the aspect ratio. Enlarging is not supported.
+//
+// This is expensive: The energy map is recomputed after each removed seam, so the cost is roughly the number of pixels times the number of removed rows and columns. For a 1000x1000 image shrunk by 20% in one direction, this means 200 full passes over the image. Scale large images down first.
+func seamCarve(img image.Image, newW, newH int) (image.Image, error) {
+	b := img.Bounds()
+	if newW <= 0 || newH <= 0 {
+		return nil, errors.New("seamCarve(): target size must be positive")
+	}
+	if newW > b.Dx() || newH > b.Dy() {
+		return nil, errors.Errorf("seamCarve(): cannot enlarge %dx%d to %dx%d", b.Dx(), b.Dy(), newW, newH)
+	}
+
+	dst := toRGBA(img)
+	dst.Rect = dst.Rect.Sub(b.Min)
+	for dst.Bounds().Dx() > newW {
+		dst = removeSeam(dst)
+	}
+	// Removing a horizontal seam is the same as removing a vertical seam from the transposed image.
+	if dst.Bounds().Dy() > newH {
+		dst = transpose(dst)
+		for dst.Bounds().Dx() > newH {
+			dst = removeSeam(dst)
+		}
+		dst = transpose(dst)
+	}
+	return dst, nil
+}
+
+// removeSeam removes the vertical seam with the least energy from `img`, which must start at (0,0).
+func removeSeam(img *image.RGBA) *image.RGBA {
+	e := computeEnergy(img, defaultEnergyWeights)
+	w, h := e.w, e.h
+
+	// Dynamic programming: cost[y*w+x] is the energy of the cheapest seam from the top row down to (x,y). It extends the cheapest of the three seams that end above it.
+	cost := make([]float64, w*h)
+	copy(cost, e.v[:w])
+	for y := 1; y < h; y++ {
+		for x := 0; x < w; x++ {
+			best := math.Inf(1)
+			for dx := -1; dx <= 1; dx++ {
+				if px := x + dx; px >= 0 && px < w {
+					best = math.Min(best, cost[(y-1)*w+px])
+				}
+			}
+			cost[y*w+x] = e.at(x, y) + best
+		}
+	}
+
+	// Find the end of the cheapest seam in the bottom row, then walk back up.
+	seam := make([]int, h)
+	for x := 1; x < w; x++ {
+		if cost[(h-1)*w+x] < cost[(h-1)*w+seam[h-1]] {
+			seam[h-1] = x
+		}
+	}
+	for y := h - 2; y >= 0; y-- {
+		x := seam[y+1]
+		seam[y] = x
+		for dx := -1; dx <= 1; dx += 2 {
+			if px := x + dx; px >= 0 && px < w && cost[y*w+px] < cost[y*w+seam[y]] {
+				seam[y] = px
+			}
+		}
+	}
+
+	// Copy each row without the seam pixel.
+	dst := image.NewRGBA(image.Rect(0, 0, w-1, h))
+	for y := 0; y < h; y++ {
+		src := img.Pix[y*img.Stride : y*img.Stride+4*w]
+		row := dst.Pix[y*dst.Stride : y*dst.Stride+4*(w-1)]
+		n := copy(row, src[:4*seam[y]])
+		copy(row[n:], src[4*(seam[y]+1):])
+	}
+	return dst
+}
+
+// transpose mirrors the image along its main diagonal, so that rows become columns. The image must start at (0,0).
+func transpose(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.SetRGBA(y, x, img.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
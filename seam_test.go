@@ -0,0 +1,36 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestSeamCarve(t *testing.T) {
+	out, err := seamCarve(grayGradient(50, 30), 40, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Bounds().Size(); got != image.Pt(40, 30) {
+		t.Errorf("gradient: got size %v, want (40,30)", got)
+	}
+
+	// The seams avoid the checkerboard, so its dark pixels all survive, unlike with a plain resize.
+	img := solidImage(50, 30, color.Gray{100})
+	draw.Draw(img, image.Rect(5, 5, 25, 25), checkerboard(20, 20, 2), image.Point{}, draw.Src)
+	out, err = seamCarve(img, 40, 27)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Bounds().Size(); got != image.Pt(40, 27) {
+		t.Errorf("checkerboard: got size %v, want (40,27)", got)
+	}
+	if got, want := 40*27-countBright(out)-grayPixels(out), 200; got != want {
+		t.Errorf("checkerboard: got %d black pixels, want %d", got, want)
+	}
+
+	if _, err := seamCarve(img, 60, 30); err == nil {
+		t.Error("enlarging: want an error")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// drawText writes `text` onto a copy of the image, for captions or watermarks. `pos` is the left end of the text's baseline, `size` the font size in pixels.
+// The font is Go Regular, which is bundled with `golang.org/x/image`, so there is no font file to install.
+func drawText(img image.Image, text string, pos image.Point, size float64, col color.Color) (image.Image, error) {
+	face, err := loadFace(nil, size)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	dst := toRGBA(img)
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot:  fixed.P(pos.X, pos.Y),
+	}
+	d.DrawString(text)
+	return dst, nil
+}
+
+// CaptionOptions controls how `caption` renders a caption.
+type CaptionOptions struct {
+	// Font is the content of a TrueType or OpenType font file. If nil, caption uses Go Regular.
+	Font []byte
+	// Size is the font size in pixels.
+	Size float64
+	// Color is the text color.
+	Color color.Color
+	// Position is the top-left corner of the text box (including the padding).
+	Position image.Point
+	// Background, if not nil, fills a box behind the text, so that it stays readable on busy images. A semi-transparent color lets the image shine through.
+	Background color.Color
+	// Padding is the space in pixels between the text and the edges of the background box.
+	Padding int
+}
+
+// caption writes `text` onto a copy of the image, optionally on top of a background box, for memes and labeled outputs.
+// Unlike `drawText`, which positions the text by its baseline, caption positions the box around the text, which is easier to align with the image edges.
+func caption(img image.Image, text string, opts CaptionOptions) (image.Image, error) {
+	face, err := loadFace(opts.Font, opts.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	col := opts.Color
+	if col == nil {
+		col = color.White
+	}
+	dst := toRGBA(img)
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(col),
+		Face: face,
+	}
+
+	// The box spans the font's full ascent and descent rather than the actual glyphs, so that captions with and without descenders get the same height.
+	m := face.Metrics()
+	textW := d.MeasureString(text).Ceil()
+	textH := (m.Ascent + m.Descent).Ceil()
+	box := image.Rect(0, 0, textW+2*opts.Padding, textH+2*opts.Padding).Add(opts.Position)
+	if opts.Background != nil {
+		draw.Draw(dst, box, image.NewUniform(opts.Background), image.Point{}, draw.Over)
+	}
+
+	d.Dot = fixed.P(box.Min.X+opts.Padding, box.Min.Y+opts.Padding).Add(fixed.Point26_6{Y: m.Ascent})
+	d.DrawString(text)
+	return dst, nil
+}
+
+// loadFace returns the font from the TrueType or OpenType data `ttf` at the given size in pixels. If `ttf` is nil, it returns the bundled Go Regular font.
+func loadFace(ttf []byte, size float64) (font.Face, error) {
+	if size <= 0 {
+		return nil, errors.New("loadFace(): font size must be positive")
+	}
+	if ttf == nil {
+		ttf = goregular.TTF
+	}
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot load the font")
+	}
+	// At 72 DPI, one point equals one pixel.
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot create the font face")
+	}
+	return face, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// changedPixels returns the number of pixels within `r` that differ from `bg`.
+func changedPixels(img image.Image, r image.Rectangle, bg color.Color) int {
+	br, bgr, bb, ba := bg.RGBA()
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if cr, cg, cb, ca := img.At(x, y).RGBA(); cr != br || cg != bgr || cb != bb || ca != ba {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestDrawText(t *testing.T) {
+	bg := color.RGBA{0, 0, 0, 255}
+	img := solidImage(200, 100, bg)
+	out, err := drawText(img, "TEST", image.Pt(5, 25), 20, color.White)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := changedPixels(out, image.Rect(0, 0, 80, 30), bg); n < 50 {
+		t.Errorf("text area: %d pixels changed, want at least 50", n)
+	}
+	if n := changedPixels(out, image.Rect(100, 40, 200, 100), bg); n != 0 {
+		t.Errorf("far from the text: %d pixels changed, want none", n)
+	}
+	if n := changedPixels(img, img.Bounds(), bg); n != 0 {
+		t.Error("drawText modified the source image")
+	}
+
+	if _, err := drawText(img, "TEST", image.Pt(5, 25), 0, color.White); err == nil {
+		t.Error("font size 0: want an error")
+	}
+}
+
+func TestCaption(t *testing.T) {
+	bg := color.RGBA{0, 0, 0, 255}
+	img := solidImage(200, 100, bg)
+	box := color.RGBA{255, 255, 0, 255}
+	out, err := caption(img, "Hello", CaptionOptions{Size: 20, Position: image.Pt(10, 10), Background: box, Padding: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The box starts at the position, and the white text covers part of it.
+	if got := out.At(10, 10); got != color.Color(box) {
+		t.Errorf("top left corner of the box: got %v, want %v", got, box)
+	}
+	if n := changedPixels(out, image.Rect(14, 14, 70, 34), box); n < 50 {
+		t.Errorf("text area: %d pixels differ from the box, want at least 50", n)
+	}
+	if n := changedPixels(out, image.Rect(0, 60, 200, 100), bg); n != 0 {
+		t.Errorf("below the caption: %d pixels changed, want none", n)
+	}
+
+	if _, err := caption(img, "Hello", CaptionOptions{Size: 20, Font: []byte("no font")}); err == nil {
+		t.Error("invalid font data: want an error")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+// tile splits the image into a grid of `tileW` x `tileH` tiles, returned row by row. The tiles in the last row and column are smaller if the image size is not a multiple of the tile size.
+// The tiles are sub-images that share pixels with `img`. `montage` puts them back together.
+func tile(img image.Image, tileW, tileH int) [][]image.Image {
+	if tileW <= 0 || tileH <= 0 {
+		return nil
+	}
+	b := img.Bounds()
+	var grid [][]image.Image
+	for y := b.Min.Y; y < b.Max.Y; y += tileH {
+		var row []image.Image
+		for x := b.Min.X; x < b.Max.X; x += tileW {
+			r := image.Rect(x, y, x+tileW, y+tileH).Intersect(b)
+			row = append(row, subImage(img, r))
+		}
+		grid = append(grid, row)
+	}
+	return grid
+}
+
+// montage assembles a grid of images, row by row, into a single image without gaps. The first row determines the column widths, and the first column determines the row heights.
+// Tiles may have been processed in between, so their bounds do not matter, only their sizes.
+func montage(grid [][]image.Image) image.Image {
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	widths := make([]int, len(grid[0]))
+	totalW := 0
+	for i, t := range grid[0] {
+		widths[i] = t.Bounds().Dx()
+		totalW += widths[i]
+	}
+	heights := make([]int, len(grid))
+	totalH := 0
+	for i, row := range grid {
+		heights[i] = row[0].Bounds().Dy()
+		totalH += heights[i]
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, totalW, totalH))
+	y := 0
+	for i, row := range grid {
+		x := 0
+		for j, t := range row {
+			if j >= len(widths) {
+				break
+			}
+			draw.Draw(dst, image.Rect(x, y, x+widths[j], y+heights[i]), t, t.Bounds().Min, draw.Src)
+			x += widths[j]
+		}
+		y += heights[i]
+	}
+	return dst
+}
+
+// splitTiles works like `tile` but returns the tiles as a flat list in row-major order, which is easier to hand out to a pool of workers, along with the grid size in tiles (X columns, Y rows). `joinTiles` reassembles the processed tiles.
+func splitTiles(img image.Image, tileW, tileH int) ([]image.Image, image.Point) {
+	grid := tile(img, tileW, tileH)
+	if len(grid) == 0 {
+		return nil, image.Point{}
+	}
+	var tiles []image.Image
+	for _, row := range grid {
+		tiles = append(tiles, row...)
+	}
+	return tiles, image.Pt(len(grid[0]), len(grid))
+}
+
+// joinTiles assembles a flat list of tiles in row-major order, as returned by `splitTiles`, into a single image with `cols` tiles per row. See `montage` for how the tile sizes are handled. If `cols` is less than 1, the result is empty.
+func joinTiles(tiles []image.Image, cols int) image.Image {
+	if cols < 1 {
+		return montage(nil)
+	}
+	var grid [][]image.Image
+	for i := 0; i < len(tiles); i += cols {
+		grid = append(grid, tiles[i:minInt(i+cols, len(tiles))])
+	}
+	return montage(grid)
+}
+
+// contactSheet lays out thumbnails of all images in a grid with `cols` columns, for previewing a batch at a glance.
+// Each image is scaled down to fit into a square cell of `thumb` x `thumb` pixels and centered within it. Cells are `gap` pixels apart, and the sheet is filled with `bg`.
+func contactSheet(imgs []image.Image, cols int, thumb int, gap int, bg color.Color) image.Image {
+	if cols < 1 {
+		cols = 1
+	}
+	rows := (len(imgs) + cols - 1) / cols
+	w := cols*thumb + (cols+1)*gap
+	h := rows*thumb + (rows+1)*gap
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+
+	for i, img := range imgs {
+		t := resizeFit(img, thumb, thumb, transform.Linear, false)
+		tb := t.Bounds()
+		cell := image.Pt(gap+(i%cols)*(thumb+gap), gap+(i/cols)*(thumb+gap))
+		at := cell.Add(image.Pt((thumb-tb.Dx())/2, (thumb-tb.Dy())/2))
+		draw.Draw(dst, image.Rectangle{at, at.Add(tb.Size())}, t, tb.Min, draw.Over)
+	}
+	return dst
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTileMontage(t *testing.T) {
+	img := colorGradient(100, 70)
+	grid := tile(img, 32, 32)
+
+	// 100x70 needs 4 columns and 3 rows; the last column is 4 pixels wide and the last row 6 pixels high.
+	if len(grid) != 3 {
+		t.Fatalf("got %d rows, want 3", len(grid))
+	}
+	for i, row := range grid {
+		if len(row) != 4 {
+			t.Fatalf("row %d: got %d tiles, want 4", i, len(row))
+		}
+	}
+	if got := grid[2][3].Bounds().Size(); got != image.Pt(4, 6) {
+		t.Errorf("corner tile: got size %v, want (4,6)", got)
+	}
+
+	if out := montage(grid); !samePixels(out, img) {
+		t.Error("montage(tile(img)) differs from img")
+	}
+	if grid := tile(img, 0, 32); grid != nil {
+		t.Errorf("tile width 0: got %d rows, want none", len(grid))
+	}
+}
+
+func TestContactSheet(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	bg := color.RGBA{0, 0, 255, 255}
+	var imgs []image.Image
+	for i := 0; i < 5; i++ {
+		imgs = append(imgs, solidImage(80, 40, red))
+	}
+	sheet := contactSheet(imgs, 3, 20, 2, bg)
+
+	// Three columns and two rows of 20-pixel cells, with a 2-pixel gap around every cell.
+	if got := sheet.Bounds().Size(); got != image.Pt(3*20+4*2, 2*20+3*2) {
+		t.Fatalf("got size %v, want (68,46)", got)
+	}
+	// The fifth thumbnail is the second cell of the second row. It is 20x10, centered vertically in the cell.
+	if got := sheet.At(22+10, 22+10); got != color.Color(red) {
+		t.Errorf("center of the fifth cell: got %v, want red", got)
+	}
+	if got := sheet.At(22+10, 22+2); got != color.Color(bg) {
+		t.Errorf("above the fifth thumbnail: got %v, want the background", got)
+	}
+	// The sixth cell stays empty.
+	if got := sheet.At(44+10, 22+10); got != color.Color(bg) {
+		t.Errorf("center of the empty sixth cell: got %v, want the background", got)
+	}
+}
+
+func TestSplitJoinTiles(t *testing.T) {
+	// 50 x 30 does not divide evenly into 16 x 16 tiles, so the last column and row are smaller.
+	img := colorGradient(50, 30)
+	tiles, grid := splitTiles(img, 16, 16)
+	if grid != image.Pt(4, 2) || len(tiles) != 8 {
+		t.Fatalf("got %d tiles in a %v grid, want 8 in (4,2)", len(tiles), grid)
+	}
+	if got := tiles[3].Bounds().Size(); got != image.Pt(2, 16) {
+		t.Errorf("last tile of the first row has size %v, want (2,16)", got)
+	}
+
+	out := joinTiles(tiles, grid.X)
+	if !samePixels(out, img) {
+		t.Error("joining the split tiles does not restore the image")
+	}
+
+	if out := joinTiles(tiles, 0); !out.Bounds().Empty() {
+		t.Errorf("cols 0: got bounds %v, want empty", out.Bounds())
+	}
+}
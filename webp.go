@@ -0,0 +1,18 @@
+//go:build webp
+// +build webp
+
+package main
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+	"github.com/pkg/errors"
+)
+
+// encodeWebP writes the image to `w` as a lossy WebP file with the given quality, from 1 to 100.
+// `chai2010/webp` wraps Google's libwebp via cgo, so this file is only built with `-tags webp`.
+func encodeWebP(w io.Writer, img image.Image, quality int) error {
+	return errors.Wrap(webp.Encode(w, img, &webp.Options{Quality: float32(quality)}), "Failed to encode the image as WebP")
+}
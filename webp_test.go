@@ -0,0 +1,41 @@
+//go:build webp
+// +build webp
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	img := colorGradient(64, 48)
+	data := encode(t, img, "webp", SaveOptions{Quality: 90})
+	out, format, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "webp" {
+		t.Errorf("decoded as %s, want webp", format)
+	}
+	if out.Bounds().Size() != img.Bounds().Size() {
+		t.Fatalf("got size %v, want %v", out.Bounds().Size(), img.Bounds().Size())
+	}
+	if mae, err := compare(img, out); err != nil || mae > 6 {
+		t.Errorf("lossy WebP at quality 90 differs by %.2f (%v), want at most 6", mae, err)
+	}
+
+	// saveImageAs picks WebP by the file extension.
+	dir := t.TempDir()
+	if err := saveImageAs(img, dir, "out.webp", SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := openImage(filepath.Join(dir, "out.webp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Bounds().Size() != img.Bounds().Size() {
+		t.Errorf("saved file: got size %v, want %v", saved.Bounds().Size(), img.Bounds().Size())
+	}
+}